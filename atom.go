@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+
+	"github.com/jgoodall/gitlab-list-tags/pkg/gitlabtags"
+)
+
+// atomFeed is an Atom (RFC 4287) feed of tags.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID        string       `xml:"id"`
+	Title     string       `xml:"title"`
+	Published string       `xml:"published,omitempty"`
+	Updated   string       `xml:"updated"`
+	Link      atomLink     `xml:"link"`
+	Author    *atomAuthor  `xml:"author,omitempty"`
+	Content   *atomContent `xml:"content,omitempty"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email,omitempty"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// printAtom writes the tags as an Atom feed with one entry per tag, using the
+// tag's commit date as the entry's published date and the tag message as its
+// content.
+func printAtom(w io.Writer, tags gitlabtags.Tags) error {
+	feed := atomFeed{
+		ID:     tagsURL(),
+		Title:  org + "/" + repo + " releases",
+		Link:   atomLink{Href: tagsURL(), Rel: "alternate"},
+		Author: atomAuthor{Name: org + "/" + repo},
+	}
+
+	var latest time.Time
+	for _, tag := range tags {
+		link := tagURL(tag.Name)
+		date := tag.Commit.CreatedAt
+		if date.After(latest) {
+			latest = date
+		}
+		e := atomEntry{
+			ID:      link,
+			Title:   tag.Name,
+			Updated: atomTime(date),
+			Link:    atomLink{Href: link, Rel: "alternate"},
+		}
+		if !date.IsZero() {
+			e.Published = atomTime(date)
+		}
+		if tag.Tagger != "" {
+			e.Author = &atomAuthor{Name: tag.Tagger}
+		} else if tag.Commit.AuthorName != "" {
+			e.Author = &atomAuthor{Name: tag.Commit.AuthorName, Email: tag.Commit.AuthorEmail}
+		}
+		switch {
+		case tag.Message != "" && renderMD:
+			e.Content = &atomContent{Type: "html", Body: renderMarkdown(tag.Message, mdHTML)}
+		case tag.Message != "":
+			e.Content = &atomContent{Type: "text", Body: tag.Message}
+		}
+		feed.Entries = append(feed.Entries, e)
+	}
+	feed.Updated = atomTime(latest)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// atomTime formats t as an RFC 3339 date, as required by Atom. A zero time,
+// for a tag without a date, is reported as the Unix epoch.
+func atomTime(t time.Time) string {
+	if t.IsZero() {
+		t = time.Unix(0, 0)
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// keyringService is the service name tokens are stored under in the OS
+// keyring.
+const keyringService = "gitlab-list-tags"
+
+// errKeyringNotFound is returned by keyringGet when no token is stored for the
+// host.
+var errKeyringNotFound = errors.New("no token in keyring")
+
+// keyringAccount returns the keyring account for the git host at rawURL: its
+// host name and port.
+func keyringAccount(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("error parsing url %s: %w", rawURL, err)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("url %s has no host", rawURL)
+	}
+	return u.Host, nil
+}
+
+// savedToken returns the token for the git host at rawURL saved by auth login
+// or, failing that, from the user's .netrc file. If the saved token is from
+// an OAuth login, oauth is true and the access token is refreshed first if it
+// has expired.
+func savedToken(ctx context.Context, hc *http.Client, rawURL string) (token string, oauth bool) {
+	if account, err := keyringAccount(rawURL); err == nil {
+		if t, err := keyringGet(keyringService, account); err == nil {
+			if !strings.HasPrefix(t, "{") {
+				return t, false
+			}
+			ot, err := loadOAuthToken(ctx, hc, rawURL, account, t)
+			if err != nil {
+				fatal("error using OAuth token", "account", account, "err", err)
+			}
+			return ot.AccessToken, true
+		}
+	}
+	return netrcToken(rawURL), false
+}
+
+// authFlags registers the flags of the auth command on fs.
+func authFlags(fs *flag.FlagSet) {
+	hostFlags(fs)
+	fs.StringVar(&oauthID, "oauth-client-id", "", "Log in with the OAuth device flow using the application ID of an OAuth application on the GitLab instance, instead of saving a personal access token")
+	fs.StringVar(&oauthScope, "oauth-scope", "read_api", "Scopes to request when logging in with OAuth")
+}
+
+// runAuth runs the auth login and auth logout commands, which save the token
+// for a git host in the OS keyring and remove it again.
+func runAuth(ctx context.Context, fs *flag.FlagSet) {
+	if fs.NArg() != 1 || (fs.Arg(0) != "login" && fs.Arg(0) != "logout") {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	if baseURL == "" && provider != "bitbucket-cloud" {
+		fatal("Please define the url.")
+	}
+	account, err := keyringAccount(hostURL())
+	if err != nil {
+		fatal("invalid url", "err", err)
+	}
+
+	if fs.Arg(0) == "logout" {
+		if err := keyringDelete(keyringService, account); err != nil {
+			fatal("error removing token from keyring", "account", account, "err", err)
+		}
+		fmt.Fprintf(os.Stderr, "Removed token for %s\n", account)
+		return
+	}
+
+	if oauthID != "" {
+		ot, err := oauthDeviceLogin(ctx, newHTTPClient(), hostURL(), oauthID, oauthScope)
+		if err != nil {
+			exitIfInterrupted(ctx)
+			fatal("error logging in", "account", account, "err", err)
+		}
+		if err := saveOAuthToken(account, ot); err != nil {
+			fatal("error saving token to keyring", "account", account, "err", err)
+		}
+		fmt.Fprintf(os.Stderr, "Saved OAuth token for %s\n", account)
+		return
+	}
+
+	readToken()
+	t := token
+	if t == "" {
+		t, err = promptToken(account)
+		if err != nil {
+			fatal("error reading token", "err", err)
+		}
+	}
+	if t == "" {
+		fatal("no token given")
+	}
+	if err := keyringSet(keyringService, account, t); err != nil {
+		fatal("error saving token to keyring", "account", account, "err", err)
+	}
+	fmt.Fprintf(os.Stderr, "Saved token for %s\n", account)
+}
+
+// promptToken asks for the token for account on stderr and reads it from
+// stdin, without echoing it when stdin is a terminal.
+func promptToken(account string) (string, error) {
+	fmt.Fprintf(os.Stderr, "Token for %s: ", account)
+	restore := disableEcho()
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	restore()
+	fmt.Fprintln(os.Stderr)
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/jgoodall/gitlab-list-tags/pkg/gitlabtags"
+)
+
+// browseHelp is the status line of the browse command when there is no
+// message to show.
+const browseHelp = "↑/↓ move  PgUp/PgDn page  J/K scroll details  y copy name  o open in browser  q quit"
+
+// browser is the state of the terminal UI of the browse command.
+type browser struct {
+	ctx  context.Context
+	c    gitlabtags.Provider
+	tags gitlabtags.Tags
+
+	sel    int // index of the selected tag
+	top    int // index of the first tag shown
+	scroll int // first line of the details shown
+
+	// commits are the commits since the previous version of each tag, by
+	// name, once they have been fetched; errs are the errors fetching them.
+	commits  map[string][]gitlabtags.Commit
+	errs     map[string]error
+	fetching map[string]bool
+	fetched  chan fetchedCommits
+
+	status     string
+	rows, cols int
+}
+
+// fetchedCommits is the result of fetching the commits of a tag.
+type fetchedCommits struct {
+	tag     string
+	commits []gitlabtags.Commit
+	err     error
+}
+
+// runBrowse shows the selected tags in a terminal UI: a list of the tags,
+// and the details of the selected one, with its message and commits.
+func runBrowse(ctx context.Context, fs *flag.FlagSet) {
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		fatal("browse needs a terminal")
+	}
+	c := newClient(ctx)
+	tags, _ := listTags(ctx, c)
+	if len(tags) == 0 {
+		slog.Warn("no tags found", "project", project())
+		exit(errNoTags)
+	}
+
+	restore, err := rawTerminal(os.Stdin, os.Stdout)
+	if err != nil {
+		fatal("error setting up the terminal", "err", err)
+	}
+	// Use the alternate screen, without a cursor, so that the screen is as
+	// it was when browsing ends.
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Print("\x1b[?25h\x1b[?1049l")
+		restore()
+	}()
+
+	b := &browser{
+		ctx:      ctx,
+		c:        c,
+		tags:     tags,
+		commits:  map[string][]gitlabtags.Commit{},
+		errs:     map[string]error{},
+		fetching: map[string]bool{},
+		fetched:  make(chan fetchedCommits),
+	}
+	keys := make(chan string)
+	go readKeys(os.Stdin, keys)
+	for {
+		b.fetchCommits()
+		b.render()
+		select {
+		case <-ctx.Done():
+			return
+		case f := <-b.fetched:
+			delete(b.fetching, f.tag)
+			b.commits[f.tag], b.errs[f.tag] = f.commits, f.err
+		case k, ok := <-keys:
+			if !ok || !b.handleKey(k) {
+				return
+			}
+		}
+	}
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// readKeys sends each key, or escape sequence such as an arrow key, read from
+// in to keys, closing it when in is closed.
+func readKeys(in *os.File, keys chan<- string) {
+	buf := make([]byte, 16)
+	for {
+		n, err := in.Read(buf)
+		if err != nil {
+			close(keys)
+			return
+		}
+		keys <- string(buf[:n])
+	}
+}
+
+// handleKey acts on the key k, reporting whether to keep browsing.
+func (b *browser) handleKey(k string) bool {
+	b.status = ""
+	page := b.rows - 2
+	switch k {
+	case "q", "\x03", "\x1b":
+		return false
+	case "j", "\x1b[B", "\x1bOB":
+		b.move(1)
+	case "k", "\x1b[A", "\x1bOA":
+		b.move(-1)
+	case " ", "\x1b[6~":
+		b.move(page)
+	case "\x1b[5~":
+		b.move(-page)
+	case "g", "\x1b[H", "\x1b[1~":
+		b.move(-len(b.tags))
+	case "G", "\x1b[F", "\x1b[4~":
+		b.move(len(b.tags))
+	case "J":
+		b.scroll++
+	case "K":
+		if b.scroll > 0 {
+			b.scroll--
+		}
+	case "y":
+		// OSC 52 sets the clipboard through the terminal, which also works
+		// over ssh.
+		name := b.tags[b.sel].Name
+		fmt.Printf("\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(name)))
+		b.status = "Copied " + name
+	case "o":
+		u := tagURL(b.tags[b.sel].Name)
+		if u == "" {
+			b.status = "The tag has no web page"
+		} else if err := openURL(u); err != nil {
+			b.status = "Error opening " + u + ": " + err.Error()
+		} else {
+			b.status = "Opened " + u
+		}
+	}
+	return true
+}
+
+// move moves the selection by n tags, keeping it in the list.
+func (b *browser) move(n int) {
+	sel := b.sel + n
+	if sel < 0 {
+		sel = 0
+	}
+	if sel >= len(b.tags) {
+		sel = len(b.tags) - 1
+	}
+	if sel != b.sel {
+		b.sel, b.scroll = sel, 0
+	}
+}
+
+// fetchCommits starts fetching the commits of the selected tag, unless they
+// have been fetched already.
+func (b *browser) fetchCommits() {
+	tag := b.tags[b.sel]
+	prev := previousTag(b.tags, b.sel)
+	if _, ok := b.commits[tag.Name]; ok || b.fetching[tag.Name] || prev == nil {
+		return
+	}
+	b.fetching[tag.Name] = true
+	go func() {
+		f := fetchedCommits{tag: tag.Name}
+		cmp, err := b.c.CompareRefs(b.ctx, project(), prev.Name, tag.Name)
+		if err != nil {
+			f.err = err
+		} else {
+			f.commits = cmp.Commits
+		}
+		select {
+		case b.fetched <- f:
+		case <-b.ctx.Done():
+		}
+	}()
+}
+
+// render draws the header, the list of tags on the left, the details of the
+// selected one on the right, and the status line.
+func (b *browser) render() {
+	b.rows, b.cols = 24, 80
+	if rows, cols, err := terminalSize(os.Stdin, os.Stdout); err == nil && rows > 2 && cols > 20 {
+		b.rows, b.cols = rows, cols
+	}
+	height := b.rows - 2
+	if b.sel < b.top {
+		b.top = b.sel
+	}
+	if b.sel >= b.top+height {
+		b.top = b.sel - height + 1
+	}
+
+	listWidth := 0
+	for _, tag := range b.tags {
+		if n := len([]rune(tag.Name)); n > listWidth {
+			listWidth = n
+		}
+	}
+	listWidth += 2
+	if listWidth > b.cols/3 {
+		listWidth = b.cols / 3
+	}
+	detailWidth := b.cols - listWidth - 3
+	details := b.details(detailWidth)
+
+	w := bufio.NewWriter(os.Stdout)
+	fmt.Fprintf(w, "\x1b[H\x1b[2J\x1b[7m%s\x1b[0m", pad(fmt.Sprintf(" %s/%s: %d tags", org, repo, len(b.tags)), b.cols))
+	for i := 0; i < height; i++ {
+		fmt.Fprintf(w, "\x1b[%d;1H", i+2)
+		if t := b.top + i; t < len(b.tags) {
+			name := pad(" "+b.tags[t].Name, listWidth)
+			if t == b.sel {
+				name = "\x1b[7m" + name + "\x1b[0m"
+			}
+			w.WriteString(name)
+		} else {
+			w.WriteString(pad("", listWidth))
+		}
+		w.WriteString(" │ ")
+		if d := b.scroll + i; d < len(details) {
+			w.WriteString(details[d])
+		}
+	}
+	status := b.status
+	if status == "" {
+		status = browseHelp
+	}
+	fmt.Fprintf(w, "\x1b[%d;1H\x1b[7m%s\x1b[0m", b.rows, pad(" "+status, b.cols))
+	w.Flush()
+}
+
+// details returns the lines describing the selected tag, wrapped to width:
+// its name, version, byline, and web page, its message, and the commits since
+// the previous version.
+func (b *browser) details(width int) []string {
+	tag := b.tags[b.sel]
+	lines := []string{"\x1b[1m" + pad(tag.Name, width) + "\x1b[0m"}
+	if tag.Parsed {
+		lines = append(lines, "Version "+tag.Version.String())
+	}
+	if by := byline(tag); by != "" {
+		lines = append(lines, by)
+	}
+	if u := tagURL(tag.Name); u != "" {
+		lines = append(lines, u)
+	}
+	if msg := strings.TrimSpace(tag.Message); msg != "" {
+		lines = append(lines, "")
+		lines = append(lines, strings.Split(msg, "\n")...)
+	}
+	if prev := previousTag(b.tags, b.sel); prev != nil {
+		lines = append(lines, "", "Commits since "+prev.Name+":")
+		commits, ok := b.commits[tag.Name]
+		switch {
+		case b.errs[tag.Name] != nil:
+			lines = append(lines, "error comparing "+prev.Name+" with "+tag.Name+": "+b.errs[tag.Name].Error())
+		case !ok:
+			lines = append(lines, "loading…")
+		case len(commits) == 0:
+			lines = append(lines, "none")
+		}
+		for i := len(commits) - 1; i >= 0; i-- {
+			lines = append(lines, "- "+commits[i].Title+" ("+commits[i].ShortID+")")
+		}
+	}
+
+	var wrapped []string
+	for i, l := range lines {
+		if i == 0 {
+			wrapped = append(wrapped, l)
+			continue
+		}
+		wrapped = append(wrapped, wrap(printable(l), width)...)
+	}
+	return wrapped
+}
+
+// printable replaces the control characters in s, such as escape sequences in
+// a tag message, with spaces, so that they cannot disturb the screen.
+func printable(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// wrap splits s into lines of at most width characters.
+func wrap(s string, width int) []string {
+	r := []rune(s)
+	if len(r) <= width || width <= 0 {
+		return []string{s}
+	}
+	var lines []string
+	for len(r) > width {
+		lines = append(lines, string(r[:width]))
+		r = r[width:]
+	}
+	return append(lines, string(r))
+}
+
+// pad returns s truncated or padded with spaces to width characters.
+func pad(s string, width int) string {
+	r := []rune(printable(s))
+	if len(r) > width {
+		return string(r[:width])
+	}
+	return string(r) + strings.Repeat(" ", width-len(r))
+}
+
+// openURL opens u in the user's web browser.
+func openURL(u string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", u)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", u)
+	default:
+		cmd = exec.Command("xdg-open", u)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
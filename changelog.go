@@ -0,0 +1,438 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jgoodall/gitlab-list-tags/pkg/gitlabtags"
+)
+
+// changelogHeader is written at the top of Keep a Changelog output.
+const changelogHeader = `# Changelog
+
+All notable changes to this project will be documented in this file.
+
+The format is based on [Keep a Changelog](https://keepachangelog.com/en/1.0.0/),
+and this project adheres to [Semantic Versioning](https://semver.org/spec/v2.0.0.html).
+`
+
+var (
+	withCommits bool
+	mrTitles    bool
+	linkIssues  bool
+	thanks      bool
+	usernames   bool
+	notesSource string
+
+	// tagNotes are the release notes of each tag, by name, generated by the
+	// host with -changelog-source gitlab.
+	tagNotes map[string]string
+
+	// tagUsernames are the usernames of commit authors, by email, found
+	// with -contributor-usernames.
+	tagUsernames map[string]string
+
+	// tagCommits are the commits since the previous tag of each tag, by
+	// name, fetched with -with-commits.
+	tagCommits map[string][]gitlabtags.Commit
+)
+
+// changelogFlags registers the flags controlling the changelog on fs.
+func changelogFlags(fs *flag.FlagSet) {
+	notesTemplateFlag(fs)
+	fs.StringVar(&notesSource, "changelog-source", "local", "How the changelog is generated: local, from tag messages and with -with-commits the commits, or gitlab, adding the notes GitLab generates from Changelog commit trailers")
+	fs.BoolVar(&withCommits, "with-commits", false, "List the commits since the previous version under each version of the changelog")
+	fs.BoolVar(&mrTitles, "mr-titles", false, "With -with-commits, list merge commits by the title of their merge request")
+	fs.BoolVar(&thanks, "contributors", false, "With -with-commits, thank the authors of the commits under each version")
+	fs.BoolVar(&usernames, "contributor-usernames", false, "With -contributors, mention authors by their GitLab username, looked up by email")
+	fs.BoolVar(&linkIssues, "link-issues", true, "Link issue references such as #123 and group/project#123 in the changelog to the issues")
+}
+
+// issueRE matches references to issues, such as "#123" or
+// "group/project#123", that are not part of a longer word or an existing
+// markdown link.
+var issueRE = regexp.MustCompile(`(^|[\s(,;])((?:[\w.+-]+/)+[\w.+-]+)?#(\d+)\b`)
+
+// linkIssueRefs rewrites the issue references in text as markdown links to
+// the issues, if -link-issues is set and the provider can link to them.
+func linkIssueRefs(text string) string {
+	if !linkIssues {
+		return text
+	}
+	return issueRE.ReplaceAllStringFunc(text, func(ref string) string {
+		m := issueRE.FindStringSubmatch(ref)
+		path := m[2]
+		if path == "" {
+			path = org + "/" + repo
+		}
+		iid, err := strconv.Atoi(m[3])
+		if err != nil {
+			return ref
+		}
+		u := issueURL(path, iid)
+		if u == "" {
+			return ref
+		}
+		return fmt.Sprintf("%s[%s#%d](%s)", m[1], m[2], iid, u)
+	})
+}
+
+// mergeRequestRE matches the reference to the merged merge request in the
+// message of a merge commit, such as "See merge request group/project!123".
+var mergeRequestRE = regexp.MustCompile(`See merge request (?:([\w.+-]+(?:/[\w.+-]+)+))?!(\d+)`)
+
+// mergeRequestRef returns the full path of the project and the IID of the
+// merge request merged by commit, or an empty path if it is not a merge
+// commit.
+func mergeRequestRef(commit gitlabtags.Commit) (string, int) {
+	m := mergeRequestRE.FindStringSubmatch(commit.Message)
+	if m == nil {
+		return "", 0
+	}
+	iid, err := strconv.Atoi(m[2])
+	if err != nil {
+		return "", 0
+	}
+	if m[1] == "" {
+		return org + "/" + repo, iid
+	}
+	return m[1], iid
+}
+
+// commitLine returns the changelog line for commit: its title and a link to
+// the merge request it merged, or its short SHA if it is not a merge commit.
+func commitLine(commit gitlabtags.Commit) string {
+	title := linkIssueRefs(commit.Title)
+	path, iid := mergeRequestRef(commit)
+	if path == "" {
+		return fmt.Sprintf("- %s (%s)", title, commit.ShortID)
+	}
+	ref := "!" + strconv.Itoa(iid)
+	if path != org+"/"+repo {
+		ref = path + ref
+	}
+	if u := mergeRequestURL(path, iid); u != "" {
+		return fmt.Sprintf("- %s ([%s](%s))", title, ref, u)
+	}
+	return fmt.Sprintf("- %s (%s)", title, ref)
+}
+
+// setMergeRequestTitles replaces the title of each merge commit in commits
+// with the title of its merge request, if -mr-titles is set.
+func setMergeRequestTitles(ctx context.Context, c gitlabtags.Provider, commits []gitlabtags.Commit) {
+	if !mrTitles {
+		return
+	}
+	f, ok := c.(gitlabtags.MergeRequestFinder)
+	if !ok {
+		fatal("the provider cannot look up merge requests", "provider", provider)
+	}
+	for i := range commits {
+		path, iid := mergeRequestRef(commits[i])
+		if path == "" {
+			continue
+		}
+		mr, err := f.MergeRequest(ctx, path, iid)
+		if err != nil {
+			exitIfInterrupted(ctx)
+			fatal("error getting merge request", "project", path, "iid", iid, "err", err)
+		}
+		commits[i].Title = mr.Title
+	}
+}
+
+// prepareChangelog fetches what the changelog flags need from the host to
+// print the changelog of tags.
+func prepareChangelog(ctx context.Context, c gitlabtags.Provider, tags gitlabtags.Tags) {
+	parseNotesTemplate()
+	switch notesSource {
+	case "", "local":
+	case "gitlab":
+		fetchTagNotes(ctx, c, tags)
+	default:
+		fatal("unknown changelog source", "changelog_source", notesSource)
+	}
+	fetchTagCommits(ctx, c, tags)
+}
+
+// fetchTagNotes sets tagNotes to the notes the host generates for each of
+// tags, from the tag before it.
+func fetchTagNotes(ctx context.Context, c gitlabtags.Provider, tags gitlabtags.Tags) {
+	g, ok := c.(gitlabtags.ChangelogGenerator)
+	if !ok {
+		fatal("the provider cannot generate changelogs", "provider", provider)
+	}
+	tagNotes = map[string]string{}
+	for i, tag := range tags {
+		prev := previousTag(tags, i)
+		if prev == nil {
+			continue
+		}
+		notes, err := g.GenerateChangelog(ctx, project(), changelogVersion(tag), prev.Name, tag.Name)
+		if err != nil {
+			exitIfInterrupted(ctx)
+			// The project exists, as its tags were listed, so Not Found
+			// means the server predates the endpoint.
+			var se *gitlabtags.StatusError
+			if errors.As(err, &se) && se.StatusCode == http.StatusNotFound {
+				fatal("-changelog-source gitlab requires GitLab 14.6 or later", "tag", tag.Name, "err", err)
+			}
+			fatal("error generating the changelog", "tag", tag.Name, "err", err)
+		}
+		tagNotes[tag.Name] = notesBody(notes)
+	}
+}
+
+// notesBody returns notes generated by the host without their version
+// heading, which the changelog has its own of.
+func notesBody(notes string) string {
+	notes = strings.TrimSpace(notes)
+	if strings.HasPrefix(notes, "## ") {
+		if i := strings.Index(notes, "\n"); i >= 0 {
+			return strings.TrimSpace(notes[i:])
+		}
+		return ""
+	}
+	return notes
+}
+
+// fetchTagCommits sets tagCommits to the commits between each of tags and
+// the tag before it, if -with-commits is set.
+func fetchTagCommits(ctx context.Context, c gitlabtags.Provider, tags gitlabtags.Tags) {
+	if !withCommits {
+		return
+	}
+	tagCommits = map[string][]gitlabtags.Commit{}
+	for i, tag := range tags {
+		prev := previousTag(tags, i)
+		if prev == nil {
+			continue
+		}
+		cmp, err := c.CompareRefs(ctx, project(), prev.Name, tag.Name)
+		if err != nil {
+			exitIfInterrupted(ctx)
+			fatal("error comparing tags", "from", prev.Name, "to", tag.Name, "err", err)
+		}
+		setMergeRequestTitles(ctx, c, cmp.Commits)
+		tagCommits[tag.Name] = cmp.Commits
+		if thanks && usernames {
+			findUsernames(ctx, c, cmp.Commits)
+		}
+	}
+}
+
+// findUsernames adds the usernames of the authors of commits to
+// tagUsernames.
+func findUsernames(ctx context.Context, c gitlabtags.Provider, commits []gitlabtags.Commit) {
+	f, ok := c.(gitlabtags.UserFinder)
+	if !ok {
+		fatal("the provider cannot look up users", "provider", provider)
+	}
+	if tagUsernames == nil {
+		tagUsernames = map[string]string{}
+	}
+	for _, commit := range commits {
+		email := strings.ToLower(commit.AuthorEmail)
+		if email == "" {
+			continue
+		}
+		if _, ok := tagUsernames[email]; ok {
+			continue
+		}
+		user, err := f.UserByEmail(ctx, email)
+		if err != nil {
+			exitIfInterrupted(ctx)
+			fatal("error looking up user", "email", email, "err", err)
+		}
+		tagUsernames[email] = ""
+		if user != nil {
+			tagUsernames[email] = user.Username
+		}
+	}
+}
+
+// contributors returns the authors of commits, in the order of their first
+// commit, as "@username" if -contributor-usernames found it and by name
+// otherwise.
+func contributors(commits []gitlabtags.Commit) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, commit := range commits {
+		name := commit.AuthorName
+		if u := tagUsernames[strings.ToLower(commit.AuthorEmail)]; u != "" {
+			name = "@" + u
+		}
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// previousTag returns the tag before tags[i]: the next one, or with -order
+// asc the one before it, or nil if there is none.
+func previousTag(tags gitlabtags.Tags, i int) *gitlabtags.Tag {
+	prev := i + 1
+	if order == "asc" {
+		prev = i - 1
+	}
+	if prev < 0 || prev >= len(tags) {
+		return nil
+	}
+	return &tags[prev]
+}
+
+// printChangelog writes the tags as a CHANGELOG.md in Keep a Changelog style:
+// a "## [version] - date" heading per tag followed by the tag message, with
+// a section listing any breaking changes described in it first, and
+// reference links comparing each version to the one before it at the end.
+// With -with-commits, the commits since the previous version are listed
+// after each tag message, with merge commits linked to their merge requests.
+// Issue references are linked to the issues, and with -contributors the
+// authors of the commits are thanked. With -notes-template, the template
+// gives the text under each heading instead. Tags are expected most recent
+// first, or oldest first with -order asc.
+func printChangelog(w io.Writer, tags gitlabtags.Tags) error {
+	if _, err := io.WriteString(w, changelogHeader); err != nil {
+		return err
+	}
+	if err := writeChangelogEntries(w, tags, len(tags)); err != nil {
+		return err
+	}
+	if len(tags) > 0 {
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	return writeChangelogLinks(w, tags, len(tags))
+}
+
+// writeChangelogEntries writes the heading and entry of each of the first n
+// of tags, each preceded by a blank line. The rest are only consulted as
+// previous versions.
+func writeChangelogEntries(w io.Writer, tags gitlabtags.Tags, n int) error {
+	for i, tag := range tags[:n] {
+		heading := "## [" + changelogVersion(tag) + "]"
+		if !tag.Commit.CreatedAt.IsZero() {
+			heading += " - " + tag.Commit.CreatedAt.Format("2006-01-02")
+		}
+		if len(tag.Aliases) > 0 {
+			heading += " (" + strings.Join(tag.Aliases, ", ") + ")"
+		}
+		entry := changelogEntry(tag)
+		if notesTmpl != nil {
+			entry = renderNotes(newReleaseNotes(tag, previousTag(tags, i), tagCommits[tag.Name]))
+		}
+		if _, err := fmt.Fprintf(w, "\n%s\n\n%s", heading, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeChangelogLinks writes the reference link of each of the first n of
+// tags, comparing it with the previous version, or to its tag page if there
+// is none.
+func writeChangelogLinks(w io.Writer, tags gitlabtags.Tags, n int) error {
+	for i, tag := range tags[:n] {
+		link := tagURL(tag.Name)
+		if prev := previousTag(tags, i); prev != nil {
+			link = compareURL(prev.Name, tag.Name)
+		}
+		if link == "" {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "[%s]: %s\n", changelogVersion(tag), link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changelogEntry returns the text under tag's heading in the changelog: any
+// breaking changes, then the rest of the tag message, then with
+// -changelog-source gitlab the notes generated by GitLab, then with
+// -with-commits the commits since the previous version and, with
+// -contributors, their authors. Each part is followed by a blank line but the
+// last.
+func changelogEntry(tag gitlabtags.Tag) string {
+	var parts []string
+	commits := tagCommits[tag.Name]
+	if changes := breakingChanges(tag, commits); len(changes) > 0 {
+		part := "### Breaking changes\n\n"
+		for _, c := range changes {
+			part += "- " + linkIssueRefs(c) + "\n"
+		}
+		parts = append(parts, part)
+	}
+	if msg := linkIssueRefs(withoutBreakingChanges(tag.Message)); msg != "" {
+		parts = append(parts, msg+"\n")
+	}
+	if notes := tagNotes[tag.Name]; notes != "" {
+		parts = append(parts, notes+"\n")
+	}
+	if len(commits) > 0 {
+		var part string
+		for j := len(commits) - 1; j >= 0; j-- {
+			part += commitLine(commits[j]) + "\n"
+		}
+		parts = append(parts, part)
+		if names := contributors(commits); thanks && len(names) > 0 {
+			parts = append(parts, "Thanks to "+strings.Join(names, ", ")+".\n")
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// breakingRE matches a "BREAKING CHANGE:" or "BREAKING-CHANGE:" marker at the
+// start of a line, as in Conventional Commits, and the paragraph after it.
+var breakingRE = regexp.MustCompile(`(?m)^BREAKING[ -]CHANGES?:[ \t]*((?:.+\n?)+)`)
+
+// blankLinesRE matches the blank lines left where paragraphs were removed.
+var blankLinesRE = regexp.MustCompile(`\n{3,}`)
+
+// withoutBreakingChanges returns msg, trimmed, without the breaking change
+// paragraphs that breakingChanges lists in a section of their own.
+func withoutBreakingChanges(msg string) string {
+	msg = breakingRE.ReplaceAllString(msg, "")
+	return strings.TrimSpace(blankLinesRE.ReplaceAllString(msg, "\n\n"))
+}
+
+// breakingChanges returns the breaking changes described in tag's message
+// and in the messages of commits, newest first, without duplicates.
+func breakingChanges(tag gitlabtags.Tag, commits []gitlabtags.Commit) []string {
+	var changes []string
+	seen := map[string]bool{}
+	add := func(text string) {
+		for _, m := range breakingRE.FindAllStringSubmatch(text, -1) {
+			c := strings.Join(strings.Fields(m[1]), " ")
+			if c != "" && !seen[c] {
+				seen[c] = true
+				changes = append(changes, c)
+			}
+		}
+	}
+	add(tag.Message)
+	for j := len(commits) - 1; j >= 0; j-- {
+		add(commits[j].Message)
+	}
+	return changes
+}
+
+// changelogVersion is the version shown for a tag in changelog headings: the
+// parsed semantic version if there is one, otherwise the tag name.
+func changelogVersion(tag gitlabtags.Tag) string {
+	if tag.Parsed {
+		return tag.Version.String()
+	}
+	return tag.Name
+}
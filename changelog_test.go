@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/jgoodall/gitlab-list-tags/pkg/gitlabtags"
+)
+
+func TestChangelogEntryBreakingChanges(t *testing.T) {
+	defer func(link bool) { linkIssues = link }(linkIssues)
+	linkIssues = false
+	tests := []struct {
+		name    string
+		message string
+		want    string
+	}{
+		{"no breaking changes", "Fix the parser.", "Fix the parser.\n"},
+		{"only breaking changes", "BREAKING CHANGE: drop -foo", "### Breaking changes\n\n- drop -foo\n"},
+		{
+			"between paragraphs",
+			"Intro\n\nBREAKING CHANGE: the -foo flag\nis gone\n\nOutro",
+			"### Breaking changes\n\n- the -foo flag is gone\n\nIntro\n\nOutro\n",
+		},
+		{
+			"several",
+			"BREAKING-CHANGE: one\n\nMiddle\n\nBREAKING CHANGES: two",
+			"### Breaking changes\n\n- one\n- two\n\nMiddle\n",
+		},
+	}
+	for _, tt := range tests {
+		if got := changelogEntry(gitlabtags.Tag{Name: "v1.0.0", Message: tt.message}); got != tt.want {
+			t.Errorf("%s: changelogEntry =\n%q\nwant\n%q", tt.name, got, tt.want)
+		}
+	}
+}
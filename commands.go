@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/jgoodall/gitlab-list-tags/pkg/gitlabtags"
+)
+
+// command is a gitlab-list-tags subcommand.
+type command struct {
+	name    string
+	args    string
+	summary string
+
+	// hidden leaves the command out of the usage and completion, for
+	// commands only packagers need.
+	hidden bool
+
+	// flags registers the command's flags, if it has any.
+	flags func(fs *flag.FlagSet)
+
+	// run executes the command once its flags are parsed.
+	run func(ctx context.Context, fs *flag.FlagSet)
+}
+
+// commands are the available subcommands. The first is run when no command
+// name is given.
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{
+			name:    "list",
+			summary: "Print the project's tags and their messages",
+			flags: func(fs *flag.FlagSet) {
+				connectionFlags(fs)
+				projectsFlags(fs)
+				selectionFlags(fs)
+				outputFlags(fs)
+			},
+			run: runList,
+		},
+		{
+			name:    "search",
+			args:    "<keyword>",
+			summary: "Print the tags of every project whose name or path contains a keyword",
+			flags: func(fs *flag.FlagSet) {
+				connectionFlags(fs)
+				concurrencyFlag(fs)
+				selectionFlags(fs)
+				outputFlags(fs)
+			},
+			run: runSearch,
+		},
+		{
+			name:    "browse",
+			summary: "Explore the project's tags, their messages, and their commits in a terminal UI",
+			flags: func(fs *flag.FlagSet) {
+				connectionFlags(fs)
+				selectionFlags(fs)
+			},
+			run: runBrowse,
+		},
+		{
+			name:    "pick",
+			args:    "[query]",
+			summary: "Choose one of the project's tags from a list narrowed by typing part of its name, and print its name",
+			flags: func(fs *flag.FlagSet) {
+				connectionFlags(fs)
+				selectionFlags(fs)
+			},
+			run: runPick,
+		},
+		{
+			name:    "changelog",
+			summary: "Print a Keep a Changelog style CHANGELOG.md",
+			flags: func(fs *flag.FlagSet) {
+				connectionFlags(fs)
+				selectionFlags(fs)
+				changelogFlags(fs)
+				outputFileFlags(fs)
+			},
+			run: runChangelog,
+		},
+		{
+			name:    "update-changelog",
+			summary: "Add the versions missing from an existing CHANGELOG.md to it",
+			flags:   updateChangelogFlags,
+			run:     runUpdateChangelog,
+		},
+		{
+			name:    "serve-webhook",
+			summary: "Listen for GitLab tag push webhooks and regenerate the changelog when tags are pushed",
+			flags:   webhookFlags,
+			run:     runServeWebhook,
+		},
+		{
+			name:    "latest",
+			summary: "Print the name of the most recent semantic version tag",
+			flags:   connectionFlags,
+			run:     runLatest,
+		},
+		{
+			name:    "check",
+			summary: "Check that every tag is a valid semantic version",
+			flags:   connectionFlags,
+			run:     runCheck,
+		},
+		{
+			name:    "release",
+			args:    "create <tag>",
+			summary: "Publish a release from an existing tag (release create)",
+			flags:   releaseFlags,
+			run:     runRelease,
+		},
+		{
+			name:    "tag",
+			args:    "delete <tag> | protected",
+			summary: "Delete a tag from the project (tag delete) or list its protected tag patterns (tag protected)",
+			flags:   tagFlags,
+			run:     runTag,
+		},
+		{
+			name:    "auth",
+			args:    "login|logout",
+			summary: "Save (auth login) or remove (auth logout) the token for a host in the OS keyring",
+			flags:   authFlags,
+			run:     runAuth,
+		},
+		{
+			name:    "completion",
+			args:    "bash|zsh|fish|powershell",
+			summary: "Print a script completing the commands, flags, profiles, and project paths of gitlab-list-tags in a shell",
+			flags:   completionFlags,
+			run:     runCompletion,
+		},
+		{
+			name:    "gen-man",
+			summary: "Write man pages for gitlab-list-tags and its commands",
+			hidden:  true,
+			flags:   genManFlags,
+			run:     runGenMan,
+		},
+		{
+			name:    "version",
+			summary: "Print the version of gitlab-list-tags, and the commit, date, and Go version it was built with",
+			flags:   versionFlags,
+			run:     runVersion,
+		},
+	}
+}
+
+// findCommand returns the command called name, or nil if there is none.
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// commandFlags returns the flags of cmd, sorted by name. Registering them
+// resets the variables they set to their defaults, so it is only for
+// commands describing the others.
+func commandFlags(cmd *command) []*flag.Flag {
+	if cmd.flags == nil {
+		return nil
+	}
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	cmd.flags(fs)
+	var flags []*flag.Flag
+	fs.VisitAll(func(f *flag.Flag) { flags = append(flags, f) })
+	return flags
+}
+
+// usage prints the list of commands on stderr.
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: gitlab-list-tags [command] [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		if !cmd.hidden {
+			fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "\nThe list command is run if no command is given. Use 'gitlab-list-tags <command> -h' for the flags of a command.\n")
+}
+
+// commandUsage prints the usage of cmd, including its flags, on stderr.
+func commandUsage(cmd *command, fs *flag.FlagSet) {
+	if cmd == commands[0] {
+		usage()
+	} else {
+		fmt.Fprintf(os.Stderr, "Usage: %s\n\n%s.\n", strings.TrimSpace("gitlab-list-tags "+cmd.name+" [flags] "+cmd.args), cmd.summary)
+	}
+	if cmd.flags != nil {
+		fmt.Fprintf(os.Stderr, "\nFlags:\n")
+		fs.PrintDefaults()
+	}
+}
+
+// runList prints the selected tags in the format chosen by the output flags.
+func runList(ctx context.Context, fs *flag.FlagSet) {
+	printer, ok := printers[output]
+	if !ok {
+		fatal("unknown output format", "output", output)
+	}
+	if tmplText != "" || tmplFile != "" {
+		tmpl, err := parseTemplate(tmplText, tmplFile)
+		if err != nil {
+			fatal("error parsing template", "err", err)
+		}
+		printer = printTemplate(tmpl)
+		output = "template"
+	}
+	if porcelain {
+		if output != "text" {
+			fatal("-porcelain cannot be used with -output or -template")
+		}
+		printer = printPorcelain
+		output = "porcelain"
+	}
+	for _, c := range strings.Split(columns, ",") {
+		if _, ok := csvColumns[c]; !ok {
+			fatal("unknown column", "columns", c)
+		}
+	}
+
+	if (latestOnly || latestMsg) && !sortSemver {
+		fatal("-latest requires -sort-semver")
+	}
+
+	if watch && (outputFile != "" || diffAgainst != "" || latestOnly || latestMsg) {
+		fatal("-watch cannot be used with -output-file, -diff-against, or -latest")
+	}
+	if metricsListen != "" && !watch {
+		fatal("-metrics-listen requires -watch")
+	}
+
+	c := newClient(ctx)
+	openOutput()
+	if projects := listProjects(ctx, c); projects != nil {
+		if diffAgainst != "" || watch {
+			fatal("-diff-against and -watch cannot be used with several projects")
+		}
+		err := printProjects(ctx, c, projects, printer)
+		closeOutput()
+		exitIfFailed(err)
+		return
+	}
+
+	if latestOnly || latestMsg {
+		tags, parseErrs := listTags(ctx, c)
+		err := printLatest(tags)
+		if err == nil {
+			recordNew(ctx, tags)
+			err = checkSigned(tags)
+		}
+		closeOutput()
+		// The latest tag is printed alone, so the tags that are not
+		// semantic versions are only reported when they are errors.
+		if strict {
+			printParseErrors(parseErrs)
+		}
+		if err != nil {
+			exitIfStrict()
+			exit(err)
+		}
+		return
+	}
+
+	if watch {
+		watchTags(ctx, c, printer)
+		return
+	}
+
+	if streamed[output] && diffAgainst == "" && !reqSigned {
+		if n, parseErrs, ok := streamTags(ctx, c, printer); ok {
+			closeOutput()
+			printParseErrors(parseErrs)
+			if n == 0 {
+				exitIfStrict()
+				exit(errNoTags)
+			}
+			return
+		}
+	}
+
+	tags, parseErrs := listTags(ctx, c)
+	if diffAgainst != "" {
+		printDiff(tags)
+		return
+	}
+	if output == "changelog" {
+		prepareChangelog(ctx, c, tags)
+	}
+
+	if err := printer(out, tags); err != nil {
+		fatal("error writing output", "output", output, "err", err)
+	}
+	recordNew(ctx, tags)
+	closeOutput()
+
+	printParseErrors(parseErrs)
+	exitIfFailed(checkSigned(tags))
+	exitIfNoTags(tags)
+}
+
+// errNoTags is the failure of a run that found no tags.
+var errNoTags = &failure{exitNoTags, "no tags matched"}
+
+// exitIfNoTags exits with exitNoTags if tags is empty, unless -only-new is
+// set, for which finding no new tags is the usual outcome.
+func exitIfNoTags(tags gitlabtags.Tags) {
+	if len(tags) == 0 && !onlyNew {
+		exitIfStrict()
+		exit(errNoTags)
+	}
+}
+
+// exitIfFailed exits with the status for err, once the output has been
+// written, if a check failed.
+func exitIfFailed(err error) {
+	if err != nil {
+		exitIfStrict()
+		exit(err)
+	}
+}
+
+// runChangelog prints the selected tags as a CHANGELOG.md.
+func runChangelog(ctx context.Context, fs *flag.FlagSet) {
+	c := newClient(ctx)
+	openOutput()
+	tags, parseErrs := listTags(ctx, c)
+	prepareChangelog(ctx, c, tags)
+
+	if err := printChangelog(out, tags); err != nil {
+		fatal("error writing changelog", "err", err)
+	}
+	recordNew(ctx, tags)
+	closeOutput()
+
+	printParseErrors(parseErrs)
+	exitIfFailed(checkSigned(tags))
+	exitIfNoTags(tags)
+}
+
+// runLatest prints the name of the highest semantic version tag. Tags that are
+// not semantic versions are ignored.
+func runLatest(ctx context.Context, fs *flag.FlagSet) {
+	sortSemver, since = true, "0.0.0"
+	tags, _ := listTags(ctx, newClient(ctx))
+	exitIfFailed(printLatest(tags))
+}
+
+// printLatest prints the name of the highest semantic version among tags, or
+// its message if -latest-message is set, returning errNoTags if there is
+// none.
+func printLatest(tags gitlabtags.Tags) error {
+	latest := latestTag(tags)
+	if latest == nil {
+		slog.Warn("no semantic version tags found", "project", project())
+		return errNoTags
+	}
+	fmt.Fprintln(out, latestText(latest))
+	return nil
+}
+
+// latestText returns the name of tag, or its message if -latest-message is
+// set.
+func latestText(tag *gitlabtags.Tag) string {
+	if latestMsg {
+		return strings.TrimSpace(tag.Message)
+	}
+	return tag.Name
+}
+
+// latestTag returns the tag with the highest semantic version among tags, or
+// nil if none of them is one.
+func latestTag(tags gitlabtags.Tags) *gitlabtags.Tag {
+	var latest *gitlabtags.Tag
+	for i, tag := range tags {
+		if tag.Parsed && (latest == nil || gitlabtags.CompareVersions(tag.Version, latest.Version) > 0) {
+			latest = &tags[i]
+		}
+	}
+	return latest
+}
+
+// runCheck reports every tag that is not a valid semantic version, exiting
+// with exitInvalidTags if there are any.
+func runCheck(ctx context.Context, fs *flag.FlagSet) {
+	sortSemver, since = true, "0.0.0"
+	tags, parseErrs := listTags(ctx, newClient(ctx))
+	if len(parseErrs) > 0 {
+		printParseErrors(parseErrs)
+		exit(&failure{exitInvalidTags, "tags are not semantic versions"})
+	}
+	fmt.Printf("%d tags checked, all are valid semantic versions\n", len(tags))
+}
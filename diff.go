@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/jgoodall/gitlab-list-tags/pkg/gitlabtags"
+)
+
+var diffAgainst string
+
+// snapshotTag is a tag read from a snapshot written by -output json.
+type snapshotTag struct {
+	Name   string `json:"name"`
+	Commit string `json:"commit"`
+}
+
+// readSnapshot reads the tags in the snapshot file at path.
+func readSnapshot(path string) ([]snapshotTag, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tags []snapshotTag
+	if err := json.Unmarshal(b, &tags); err != nil {
+		return nil, fmt.Errorf("%s is not a snapshot written by -output json: %w", path, err)
+	}
+	return tags, nil
+}
+
+// printDiff prints the differences between tags and the snapshot given by
+// -diff-against: a line starting with + for each added tag, with - for each
+// removed tag, and with ~ for each tag moved to another commit. It exits with
+// a non-zero status if any tag was removed or moved.
+func printDiff(tags gitlabtags.Tags) {
+	old, err := readSnapshot(diffAgainst)
+	if err != nil {
+		fatal("error reading snapshot", "diff_against", diffAgainst, "err", err)
+	}
+	current := map[string]string{}
+	for _, tag := range tags {
+		current[tag.Name] = tag.Commit.ID
+	}
+	previous := map[string]string{}
+	for _, tag := range old {
+		previous[tag.Name] = tag.Commit
+	}
+
+	var changed bool
+	for _, tag := range tags {
+		commit, ok := previous[tag.Name]
+		switch {
+		case !ok:
+			fmt.Fprintf(out, "+ %s %s\n", tag.Name, tag.Commit.ID)
+		case commit != tag.Commit.ID:
+			fmt.Fprintf(out, "~ %s %s -> %s\n", tag.Name, commit, tag.Commit.ID)
+			changed = true
+		}
+	}
+	for _, tag := range old {
+		if _, ok := current[tag.Name]; !ok {
+			fmt.Fprintf(out, "- %s %s\n", tag.Name, tag.Commit)
+			changed = true
+		}
+	}
+	closeOutput()
+	if changed {
+		exit(&failure{exitError, "tags were moved or deleted"})
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/jgoodall/gitlab-list-tags/pkg/gitlabtags"
+)
+
+// Exit statuses, so that scripts can tell why a run failed.
+const (
+	exitError       = 1   // any failure not listed below
+	exitUsage       = 2   // invalid command line
+	exitNoTags      = 3   // no tags matched the selection flags
+	exitNotFound    = 4   // the project, or another resource, does not exist
+	exitAuth        = 5   // the token is missing, invalid, or lacks access
+	exitNetwork     = 6   // the host could not be reached
+	exitInvalidTags = 7   // some tags failed a check, such as -strict or -require-signed
+	exitInterrupted = 130 // interrupted by SIGINT or SIGTERM
+)
+
+// failure is the error of a run that worked, but whose outcome is a failure,
+// such as finding no tags or tags that fail a check, with its exit status.
+type failure struct {
+	status int
+	msg    string
+}
+
+func (f *failure) Error() string {
+	return f.msg
+}
+
+// exitStatus returns the exit status for a run that failed with err.
+func exitStatus(err error) int {
+	var f *failure
+	if errors.As(err, &f) {
+		return f.status
+	}
+	var se *gitlabtags.StatusError
+	if errors.As(err, &se) {
+		switch se.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return exitAuth
+		case http.StatusNotFound:
+			return exitNotFound
+		}
+		return exitError
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return exitNetwork
+	}
+	return exitError
+}
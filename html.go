@@ -0,0 +1,78 @@
+package main
+
+import (
+	"html/template"
+	"io"
+
+	"github.com/jgoodall/gitlab-list-tags/pkg/gitlabtags"
+)
+
+// htmlPage is the standalone page written by printHTML.
+var htmlPage = template.Must(template.New("html").Funcs(template.FuncMap{
+	"version": changelogVersion,
+	"byline":  byline,
+	"tagURL":  tagURL,
+	"message": htmlMessage,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Project}} release history</title>
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: 2em auto; padding: 0 1em; }
+nav ul { list-style: none; padding: 0; }
+nav li { display: inline; margin-right: 1em; }
+pre { white-space: pre-wrap; background: #f6f8fa; padding: 1em; }
+time { color: #666; }
+</style>
+</head>
+<body>
+<h1>{{.Project}} release history</h1>
+<nav>
+<ul>
+{{- range .Tags}}
+<li><a href="#{{.Name}}">{{version .}}</a></li>
+{{- end}}
+</ul>
+</nav>
+{{- range .Tags}}
+<section id="{{.Name}}">
+<h2><a href="#{{.Name}}">{{version .}}</a></h2>
+{{- if not .Commit.CreatedAt.IsZero}}
+<p><time datetime="{{.Commit.CreatedAt.Format "2006-01-02T15:04:05Z07:00"}}">{{.Commit.CreatedAt.Format "2006-01-02"}}</time></p>
+{{- end}}
+{{- with byline .}}
+<p>{{.}}</p>
+{{- end}}
+{{- with tagURL .Name}}
+<p><a href="{{.}}">{{.}}</a></p>
+{{- end}}
+{{- with message .Message}}
+{{.}}
+{{- end}}
+</section>
+{{- end}}
+</body>
+</html>
+`))
+
+// htmlMessage returns the HTML of a tag message: rendered as markdown with
+// -render-markdown, and otherwise preformatted as it is.
+func htmlMessage(message string) template.HTML {
+	switch {
+	case message == "":
+		return ""
+	case renderMD:
+		return template.HTML(renderMarkdown(message, mdHTML))
+	}
+	return template.HTML("<pre>" + template.HTMLEscapeString(message) + "</pre>")
+}
+
+// printHTML writes the tags as a standalone HTML page with an anchor for each
+// version.
+func printHTML(w io.Writer, tags gitlabtags.Tags) error {
+	return htmlPage.Execute(w, struct {
+		Project string
+		Tags    gitlabtags.Tags
+	}{org + "/" + repo, tags})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// The macOS keyring is the login keychain, managed with security(1).
+
+// keyringGet returns the secret stored for account under service.
+func keyringGet(service, account string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w").Output()
+	if err != nil {
+		return "", errKeyringNotFound
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+// keyringSet stores secret for account under service. The command is given
+// to security's interactive mode on its stdin, so that the secret never
+// appears in the process's arguments; given -w with no value instead,
+// security would prompt for it on the terminal rather than read it from stdin.
+func keyringSet(service, account, secret string) error {
+	if strings.ContainsAny(secret, "\r\n") {
+		return errors.New("the secret cannot contain a line break")
+	}
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader("add-generic-password -U -s " + securityQuote(service) + " -a " + securityQuote(account) + " -w " + securityQuote(secret) + "\n")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return err
+	}
+	// security -i may exit successfully whatever its commands do, so any
+	// output other than its prompts is taken for an error: a command that
+	// works prints nothing.
+	if msg := strings.TrimSpace(strings.ReplaceAll(string(out), "security> ", "")); msg != "" {
+		return errors.New(msg)
+	}
+	return nil
+}
+
+// securityQuote quotes s as a single argument of a command line of security's
+// interactive mode, in double quotes, with backslashes and double quotes in
+// it escaped.
+func securityQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// keyringDelete removes the secret stored for account under service.
+func keyringDelete(service, account string) error {
+	return exec.Command("security", "delete-generic-password", "-s", service, "-a", account).Run()
+}
+
+// disableEcho turns off echoing of terminal input, returning a function that
+// turns it back on.
+func disableEcho() func() {
+	return sttyEcho()
+}
@@ -0,0 +1,39 @@
+//go:build !darwin && !windows
+// +build !darwin,!windows
+
+package main
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// Elsewhere the keyring is the Secret Service (GNOME Keyring, KWallet),
+// managed with secret-tool(1) from libsecret.
+
+// keyringGet returns the secret stored for account under service.
+func keyringGet(service, account string) (string, error) {
+	out, err := exec.Command("secret-tool", "lookup", "service", service, "account", account).Output()
+	if err != nil || len(out) == 0 {
+		return "", errKeyringNotFound
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+// keyringSet stores secret for account under service.
+func keyringSet(service, account, secret string) error {
+	cmd := exec.Command("secret-tool", "store", "--label", service+" "+account, "service", service, "account", account)
+	cmd.Stdin = strings.NewReader(secret)
+	return cmd.Run()
+}
+
+// keyringDelete removes the secret stored for account under service.
+func keyringDelete(service, account string) error {
+	return exec.Command("secret-tool", "clear", "service", service, "account", account).Run()
+}
+
+// disableEcho turns off echoing of terminal input, returning a function that
+// turns it back on.
+func disableEcho() func() {
+	return sttyEcho()
+}
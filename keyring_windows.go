@@ -0,0 +1,112 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// On Windows the keyring is the Credential Manager, used through the
+// advapi32 Cred* functions.
+
+var (
+	advapi32       = syscall.NewLazyDLL("advapi32.dll")
+	procCredReadW  = advapi32.NewProc("CredReadW")
+	procCredWriteW = advapi32.NewProc("CredWriteW")
+	procCredDelete = advapi32.NewProc("CredDeleteW")
+	procCredFree   = advapi32.NewProc("CredFree")
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+)
+
+// credential is the CREDENTIALW structure.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// credTarget is the Credential Manager target name for account.
+func credTarget(service, account string) (*uint16, error) {
+	return syscall.UTF16PtrFromString(service + ":" + account)
+}
+
+// keyringGet returns the secret stored for account under service.
+func keyringGet(service, account string) (string, error) {
+	target, err := credTarget(service, account)
+	if err != nil {
+		return "", err
+	}
+	var cred *credential
+	r, _, _ := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if r == 0 {
+		return "", errKeyringNotFound
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+	blob := unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)
+	return string(blob), nil
+}
+
+// keyringSet stores secret for account under service.
+func keyringSet(service, account, secret string) error {
+	target, err := credTarget(service, account)
+	if err != nil {
+		return err
+	}
+	user, err := syscall.UTF16PtrFromString(account)
+	if err != nil {
+		return err
+	}
+	blob := []byte(secret)
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		CredentialBlobSize: uint32(len(blob)),
+		Persist:            credPersistLocalMachine,
+		UserName:           user,
+	}
+	if len(blob) > 0 {
+		cred.CredentialBlob = &blob[0]
+	}
+	r, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0)
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// keyringDelete removes the secret stored for account under service.
+func keyringDelete(service, account string) error {
+	target, err := credTarget(service, account)
+	if err != nil {
+		return err
+	}
+	r, _, err := procCredDelete.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0)
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// disableEcho turns off echoing of console input, returning a function that
+// turns it back on.
+func disableEcho() func() {
+	h := syscall.Handle(syscall.Stdin)
+	var mode uint32
+	if syscall.GetConsoleMode(h, &mode) != nil {
+		return func() {}
+	}
+	procSetConsoleMode.Call(uintptr(h), uintptr(mode&^enableEchoInput))
+	return func() { procSetConsoleMode.Call(uintptr(h), uintptr(mode)) }
+}
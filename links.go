@@ -0,0 +1,49 @@
+package main
+
+import "github.com/jgoodall/gitlab-list-tags/pkg/gitlabtags"
+
+// The link functions return the URLs of pages in the web UI of the git host,
+// or an empty string if the provider cannot link to its web UI.
+
+// tagsURL returns the URL of the page listing the project's tags.
+func tagsURL() string {
+	if l, ok := client.(gitlabtags.Linker); ok {
+		return l.TagsURL(org + "/" + repo)
+	}
+	return ""
+}
+
+// tagURL returns the URL of the page for the tag called name.
+func tagURL(name string) string {
+	if l, ok := client.(gitlabtags.Linker); ok {
+		return l.TagURL(org+"/"+repo, name)
+	}
+	return ""
+}
+
+// compareURL returns the URL of the page comparing the tag from with the later
+// tag to.
+func compareURL(from, to string) string {
+	if l, ok := client.(gitlabtags.Linker); ok {
+		return l.CompareURL(org+"/"+repo, from, to)
+	}
+	return ""
+}
+
+// mergeRequestURL returns the URL of the page for the merge request with the
+// given IID in the project with the full path project.
+func mergeRequestURL(project string, iid int) string {
+	if l, ok := client.(gitlabtags.MergeRequestLinker); ok {
+		return l.MergeRequestURL(project, iid)
+	}
+	return ""
+}
+
+// issueURL returns the URL of the page for the issue with the given IID in the
+// project with the full path project.
+func issueURL(project string, iid int) string {
+	if l, ok := client.(gitlabtags.IssueLinker); ok {
+		return l.IssueURL(project, iid)
+	}
+	return ""
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"os"
+)
+
+var logFormat string
+
+// logFlags registers the flag choosing the format of the log on fs.
+func logFlags(fs *flag.FlagSet) {
+	fs.StringVar(&logFormat, "log-format", "text", "Format of the log on stderr: text, as key=value pairs, or json, one object per line")
+}
+
+// setupLogging has slog write the log to stderr in the format chosen by
+// -log-format. Each record has a message, and attributes with consistent
+// keys: err for the error, and the names of the flags, with underscores,
+// such as project or order_by, for the values they relate to.
+func setupLogging() {
+	// Writes go through progressWriter, so that they do not run into the
+	// progress line.
+	w := progressWriter{os.Stderr}
+	if logFormat == "json" {
+		slog.SetDefault(slog.New(slog.NewJSONHandler(w, nil)))
+		return
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(w, nil)))
+	if logFormat != "" && logFormat != "text" {
+		fatal("unknown -log-format", "log_format", logFormat)
+	}
+}
+
+// fatal logs msg as an error, with the key and value pairs in args, and
+// exits with the status exitStatus returns for the first error among their
+// values, or exitError if there is none.
+func fatal(msg string, args ...interface{}) {
+	slog.Error(msg, args...)
+	for _, a := range args {
+		if e, ok := a.(error); ok {
+			exit(e)
+		}
+	}
+	flushTraces(nil)
+	os.Exit(exitError)
+}
+
+// exit ends the span of the run with err, exports the spans, and exits with
+// the status exitStatus returns for err.
+func exit(err error) {
+	flushTraces(err)
+	os.Exit(exitStatus(err))
+}
@@ -1,151 +1,728 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"crypto/tls"
-	"encoding/json"
+	"crypto/x509"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
-	"sort"
+	"os/signal"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/blang/semver"
+	"github.com/jgoodall/gitlab-list-tags/pkg/gitlabtags"
 )
 
-// Tag is the individual tag from gitlab, with addition of Version.
-type Tag struct {
-	Version semver.Version `json:"-"`
-	Name    string         `json:"name"`
-	Message string         `json:"message"`
-}
-
-// Tags is the array of gitlab tags.
-type Tags []Tag
-
-func (a Tags) Len() int      { return len(a) }
-func (a Tags) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
-
-// This is a reverse sort - most recent first, hence > instead of <.
-func (a Tags) Less(i, j int) bool { return a[i].Version.GT(a[j].Version) }
-
 var (
+	provider   string
+	profile    string
 	baseURL    string
 	token      string
+	tokenFile  string
+	tokenStdin bool
+	proxyURL   string
+	caCert     string
+	clientCert string
+	clientKey  string
+	retries    int
+	retryWait  time.Duration
+	jitter     float64
+	maxRPS     float64
+	timeout    time.Duration
+	idleConns  int
+	keepAlive  time.Duration
+	useHTTP2   bool
+	tlsMin     string
+	etagCache  bool
+	cachePath  string
+	cacheTTL   time.Duration
+	verbose    bool
+	vverbose   bool
+	oauthID    string
+	oauthScope string
 	org        string
+	projectID  string
+	fullPath   string
 	repo       string
 	namePrefix string
 	insecure   bool
 	sortSemver bool
+	sortKey    string
+	order      string
+	orderBy    string
 	since      string
+	until      string
+	includePre bool
+	stableOnly bool
+	tagPrefix  string
+	stripPre   string
+	search     string
+	match      string
+	excludes   stringsFlag
+	maxTags    int
+	limit      int
+	pageJobs   int
+	memoryTags int
+	onlyNew    bool
+	dedupe     bool
+	annotated  bool
+	releases   bool
+	strict     bool
+	coerce     bool
+	scheme     string
+	versionRE  string
+	signatures bool
+	reqSigned  bool
+	statePath  string
+	output     string
+	latestOnly bool
+	latestMsg  bool
+	columns    string
+	tmplText   string
+	tmplFile   string
+	porcelain  bool
+	quiet      bool
 )
 
-func init() {
-	flag.StringVar(&baseURL, "url", "", "Base GitLab URL formatted as https://gitlab.example.com/")
-	flag.StringVar(&token, "token", "", "Personal access token (create one in your GitLab instance at '/profile/personal_access_tokens'; be sure to check 'Api: Access your API')")
-	flag.StringVar(&org, "org", "", "Organization name")
-	flag.StringVar(&repo, "repo", "", "Repository name")
-	flag.StringVar(&namePrefix, "version-prefix", "", "Text to put before the version name (e.g. '#' for markdown header)")
-	flag.BoolVar(&insecure, "insecure", false, "Do not check the server's certificate")
-	flag.BoolVar(&sortSemver, "sort-semver", true, "Sort by tag name according to semantic versioning from most recent to oldest")
-	flag.StringVar(&since, "since-tag", "0.0.0", "Print tags that are greater than or equal to the specified semantic version (e.g. 1.0.0 will show all tags/messages since 1.0.0)")
+// stringsFlag is a flag.Value collecting the values of a flag that may be
+// given more than once.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string { return strings.Join(*s, ",") }
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// hostFlags registers the flags identifying and authenticating to the GitLab
+// instance on fs.
+func hostFlags(fs *flag.FlagSet) {
+	fs.StringVar(&profile, "profile", "", "Name of the profile in the config file to take defaults from")
+	fs.StringVar(&provider, "provider", "gitlab", "Git host: "+strings.Join(gitlabtags.ProviderNames(), ", "))
+	fs.StringVar(&baseURL, "url", "", "Base GitLab URL formatted as https://gitlab.example.com/ (defaults to the Bitbucket Cloud API for bitbucket-cloud)")
+	fs.StringVar(&token, "token", "", "Personal access token (create one in your GitLab instance at '/profile/personal_access_tokens'; be sure to check 'Api: Access your API'); if not given, the token saved by 'auth login' or the password for the host in ~/.netrc is used")
+	fs.StringVar(&tokenFile, "token-file", "", "File to read the token from")
+	fs.BoolVar(&tokenStdin, "token-stdin", false, "Read the token from stdin")
+	fs.BoolVar(&insecure, "insecure", false, "Do not check the server's certificate")
+	fs.StringVar(&caCert, "ca-cert", "", "PEM file of additional CA certificates to trust, e.g. for a private CA")
+	fs.StringVar(&clientCert, "client-cert", "", "PEM file of the client certificate to present, for servers requiring client certificate authentication")
+	fs.StringVar(&clientKey, "client-key", "", "PEM file of the private key of -client-cert (defaults to -client-cert, for a file holding both)")
+	fs.StringVar(&proxyURL, "proxy", "", "URL of the proxy to connect through (by default HTTP_PROXY, HTTPS_PROXY, and NO_PROXY are honored)")
+	tunnelFlags(fs)
+	fs.DurationVar(&timeout, "timeout", time.Minute, "Maximum time to wait for the server to respond to each request")
+	fs.IntVar(&idleConns, "max-idle-conns", 0, "Maximum number of idle connections to the server kept open for reuse (0 for one for each request that may be made at once)")
+	fs.DurationVar(&keepAlive, "keep-alive", 90*time.Second, "Time an idle connection to the server is kept open for reuse (0 closes each connection after its request)")
+	fs.BoolVar(&useHTTP2, "http2", true, "Use HTTP/2 when the server supports it")
+	fs.StringVar(&tlsMin, "tls-min-version", "1.2", "Minimum TLS version to accept from the server: 1.0, 1.1, 1.2, or 1.3")
+	fs.BoolVar(&etagCache, "etag-cache", true, "Cache responses and revalidate them with ETags on later runs")
+	fs.StringVar(&cachePath, "cache-dir", cacheDir(), "Directory to cache responses in (empty disables caching)")
+	fs.DurationVar(&cacheTTL, "cache-ttl", 0, "Time for which cached responses are used without contacting the server (e.g. 10m)")
+	fs.IntVar(&retries, "retries", 3, "Number of times to retry a request that fails with a network error or server error")
+	fs.DurationVar(&retryWait, "retry-backoff", time.Second, "Wait before the first retry, doubling for each further retry")
+	fs.Float64Var(&jitter, "retry-jitter", 0.5, "Fraction of each retry wait, from 0 to 1, that is randomized")
+	fs.Float64Var(&maxRPS, "max-rps", 0, "Maximum API requests per second (0 for no limit); rate limit responses from the server are always honored")
+	fs.BoolVar(&verbose, "v", false, "Log each request to the server, with its response status, page, and time, on stderr")
+	fs.BoolVar(&vverbose, "vv", false, "Like -v, also logging the request and response headers, with tokens redacted")
+}
+
+// connectionFlags registers the flags identifying the GitLab instance and
+// project on fs.
+func connectionFlags(fs *flag.FlagSet) {
+	hostFlags(fs)
+	fs.StringVar(&org, "org", "", "Organization name, including any subgroups (e.g. group/subgroup; Bitbucket workspace or project key)")
+	fs.StringVar(&repo, "repo", "", "Repository name")
+	fs.StringVar(&fullPath, "project", "", "Full path of the project, instead of -org and -repo (e.g. group/subgroup/project)")
+	fs.StringVar(&projectID, "project-id", "", "Numeric ID of the GitLab project, instead of -org and -repo (e.g. $CI_PROJECT_ID)")
+}
+
+// selectionFlags registers the flags choosing which tags are listed, and in
+// what order, on fs.
+func selectionFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&sortSemver, "sort-semver", true, "Sort by tag name according to semantic versioning from most recent to oldest; if false, tags are sorted by name with the numbers in it compared as numbers, unless -order-by is given")
+	fs.StringVar(&tagPrefix, "tag-prefix", "", "Include only tags starting with this prefix, removing it before parsing versions (e.g. 'servicefoo/' for the tags of one component of a monorepo)")
+	fs.StringVar(&stripPre, "strip-prefixes", "v", "Comma separated prefixes removed from the start of tag names before parsing versions (e.g. 'v,release-,rel/')")
+	fs.StringVar(&search, "search", "", "Include only tags whose names contain this text, or start with it after a leading ^ or end with it before a trailing $; GitLab filters the tags itself")
+	fs.StringVar(&match, "match", "", "Regular expression matching the names of the tags to include (e.g. '^v[0-9]')")
+	fs.Var(&excludes, "exclude", "Regular expression matching the names of tags to leave out (e.g. '-nightly$'); may be repeated")
+	fs.BoolVar(&annotated, "annotated-only", false, "Include only annotated tags, leaving out lightweight ones such as deploy markers")
+	fs.StringVar(&sortKey, "sort", "semver", "Order to print tags in: semver, by version, date, by commit date, or name, by name with the numbers in it compared as numbers (v10 after v9), for tags that are not versions")
+	fs.StringVar(&order, "order", "desc", "Sort direction: desc, most recent first, or asc, oldest first")
+	fs.StringVar(&orderBy, "order-by", "", "Have GitLab sort the tags by name, updated, or version, in the -order direction, instead of sorting them here")
+	fs.StringVar(&since, "since-tag", "0.0.0", "Print tags that are greater than or equal to the specified semantic version (e.g. 1.0.0 will show all tags/messages since 1.0.0)")
+	fs.StringVar(&until, "until-tag", "", "Print tags that are less than or equal to the specified semantic version (e.g. with -since-tag 1.4.0, -until-tag 2.0.0 shows the tags from 1.4.0 to 2.0.0)")
+	fs.BoolVar(&includePre, "include-prerelease", true, "Include pre-release versions such as 1.0.0-rc.1")
+	fs.BoolVar(&stableOnly, "stable-only", false, "Leave out pre-release versions; the same as -include-prerelease=false")
+	fs.StringVar(&scheme, "version-scheme", "semver", "How versions are parsed from tag names: semver, for semantic versions, or calver, for calendar versions such as YYYY.MM.DD or YY.MM.MICRO")
+	fs.StringVar(&versionRE, "version-regex", "", "Regular expression matching whole tag names, after -strip-prefixes, whose capture groups are the numbers their versions are compared by, instead of -version-scheme (e.g. 'release-(\\d+)\\.(\\d+)')")
+	fs.BoolVar(&coerce, "coerce-versions", false, "Parse tag names that are almost semantic versions, such as 1.2 as 1.2.0, and 1.2.3.4 as 1.2.3 with 4 as build metadata, rather than reporting them")
+	fs.BoolVar(&strict, "strict", false, "Exit with a non-zero status if any tag is not a semantic version, after printing the others, for pipelines that enforce tag naming")
+	fs.BoolVar(&dedupe, "dedupe-commits", false, "Collapse the tags pointing at the same commit (e.g. 1.2.0 and latest) into one, printed with the names of the others as its aliases")
+	fs.IntVar(&maxTags, "max-tags", 0, "Maximum number of tags to retrieve from the API (0 retrieves all pages)")
+	fs.IntVar(&limit, "limit", 0, "Maximum number of tags to print, after sorting and filtering (0 prints all)")
+	fs.IntVar(&pageJobs, "page-concurrency", 4, "Number of pages of tags to fetch at once")
+	fs.IntVar(&memoryTags, "max-memory-tags", 10000, "Maximum number of tags to hold in memory while sorting text, porcelain, or jsonl output; the rest are kept in temporary files (0 holds them all)")
+	fs.BoolVar(&releases, "releases", false, "List releases, with their titles, descriptions, and assets, instead of tags")
+	fs.BoolVar(&signatures, "signatures", false, "Show whether each tag's commit is signed and the signature verified")
+	fs.BoolVar(&reqSigned, "require-signed", false, "Exit with a non-zero status if any listed tag's commit is not signed with a verified signature (implies -signatures)")
+	fs.BoolVar(&onlyNew, "only-new", false, "Print only tags with a greater semantic version than the latest tag seen by the previous run with -only-new")
+	fs.StringVar(&statePath, "state-file", stateFile(), "File recording the latest tag seen in each project for -only-new")
+	fs.BoolVar(&quiet, "quiet", false, "Do not print warnings, such as the tags that are not semantic versions, or progress on stderr")
+	notifyFlags(fs)
+}
+
+// outputFlags registers the flags controlling the list output format on fs.
+func outputFlags(fs *flag.FlagSet) {
+	fs.StringVar(&namePrefix, "version-prefix", "", "Text to put before the version name (e.g. '#' for markdown header)")
+	fs.BoolVar(&latestOnly, "latest", false, "Print only the name of the highest semantic version tag selected, for scripts")
+	fs.BoolVar(&latestMsg, "latest-message", false, "Print only the message of the highest semantic version tag selected")
+	markdownFlag(fs)
+	changelogFlags(fs)
+	outputFileFlags(fs)
+	watchFlags(fs)
+	fs.StringVar(&diffAgainst, "diff-against", "", "Print the tags added, removed, or moved to another commit since a snapshot written by -output json, instead of the tags; exits with a non-zero status if any were removed or moved")
+	fs.BoolVar(&porcelain, "porcelain", false, "Print one line per tag of tab separated fields, in a format for scripts that will not change: project, name, version, commit, and date")
+	fs.StringVar(&output, "output", "text", "Output format: text, json, jsonl (a JSON object per line, streamed as pages are retrieved if the tags need not be sorted here), csv, tsv, changelog, html, or atom")
+	fs.StringVar(&tmplText, "template", "", "Go text/template rendered for each tag (e.g. '- {{.Name}}: {{firstLine .Message}}'); overrides -output")
+	fs.StringVar(&tmplFile, "template-file", "", "File containing a Go text/template rendered for each tag; overrides -output")
+	fs.StringVar(&columns, "columns", "name,version,date,author,message", "Comma separated columns for csv and tsv output (name, version, date, aliases, annotated, commit, short_commit, url, commit_url, tagger, tagged_date, author, author_email, authored_date, committer, committer_email, committed_date, message, protected, signature, title, assets)")
 }
 
 func main() {
 
-	flag.Parse()
+	args := os.Args[1:]
+
+	// Without a command name, behave as the list command so existing
+	// invocations keep working.
+	cmd := commands[0]
+	if len(args) > 0 && (args[0] == "--version" || args[0] == "-version") {
+		args[0] = "version"
+	}
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd = findCommand(args[0])
+		if cmd == nil {
+			fmt.Fprintf(os.Stderr, "unknown command %s\n\n", args[0])
+			usage()
+			os.Exit(exitUsage)
+		}
+		args = args[1:]
+	}
+
+	fs := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	fs.Usage = func() { commandUsage(cmd, fs) }
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	logFlags(fs)
+	fs.Parse(args)
+	configErr := applyConfig(fs)
+	setupLogging()
+	if configErr != nil {
+		fatal("invalid configuration", "err", configErr)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, endTrace := startTracing(ctx, cmd.name)
+	cmd.run(ctx, fs)
+	endTrace()
+	exitIfStrict()
+
+}
+
+// client is the provider for the git host chosen by the connection flags.
+var client gitlabtags.Provider
+
+// newClient checks that the git host and project were given and returns a
+// provider for the host.
+func newClient(ctx context.Context) gitlabtags.Provider {
+	if fullPath != "" {
+		i := strings.LastIndex(fullPath, "/")
+		if i <= 0 || i == len(fullPath)-1 {
+			fatal("project is not a full path such as group/project", "project", fullPath)
+		}
+		org, repo = fullPath[:i], fullPath[i+1:]
+	}
+	if projectID == "" && !multiProject() && (org == "" || repo == "") {
+		fatal("Please define the url, token, and either org and repo, project, or project-id.")
+	}
+
+	hc := newHTTPClient()
 
-	if baseURL == "" || org == "" || repo == "" {
-		log.Fatal("Please define the url, token, org, and repo.")
+	readToken()
+	var oauth bool
+	if token == "" {
+		token = ciJobToken()
+	}
+	if token == "" {
+		token, oauth = savedToken(ctx, hc, hostURL())
 	}
 
-	sinceVers, err := semver.Parse(since)
+	var err error
+	client, err = gitlabtags.NewProvider(provider, gitlabtags.Config{
+		BaseURL:    baseURL,
+		Token:      token,
+		JobToken:   token != "" && token == os.Getenv("CI_JOB_TOKEN"),
+		OAuthToken: oauth,
+		HTTPClient: hc,
+	})
 	if err != nil {
-		log.Fatalf("unable to parse since version %s: %s", since, err)
+		fatal("error setting up the provider", "provider", provider, "err", err)
+	}
+	if projectID != "" {
+		resolveProjectID(ctx)
 	}
+	return client
+}
 
-	if !strings.HasSuffix(baseURL, "/") {
-		baseURL += "/"
+// project returns the project to pass to the provider: the -project-id if it
+// was given, otherwise the path made of org and repo.
+func project() string {
+	if projectID != "" {
+		return projectID
 	}
+	return org + "/" + repo
+}
 
-	url, err := url.Parse(baseURL + "api/v4/projects/" + org + "%2F" + repo + "/repository/tags")
+// resolveProjectID sets org and repo from the path of the project with the
+// ID given by -project-id, for naming the project and linking to its pages.
+func resolveProjectID(ctx context.Context) {
+	f, ok := client.(gitlabtags.ProjectFinder)
+	if !ok {
+		fatal("the provider does not support -project-id", "provider", provider)
+	}
+	p, err := f.Project(ctx, projectID)
 	if err != nil {
-		log.Fatalf("error parsing url %s: %s", baseURL, err)
+		exitIfInterrupted(ctx)
+		fatal("error looking up project", "project_id", projectID, "err", err)
+	}
+	i := strings.LastIndex(p.PathWithNamespace, "/")
+	org, repo = p.PathWithNamespace[:i], p.PathWithNamespace[i+1:]
+}
+
+// newHTTPClient returns the HTTP client configured by the connection flags.
+func newHTTPClient() *http.Client {
+	tr := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConnsPerHost:   maxIdleConns(),
+		IdleConnTimeout:       keepAlive,
+		DisableKeepAlives:     keepAlive == 0,
+		ForceAttemptHTTP2:     useHTTP2,
+	}
+	tr.MaxIdleConns = tr.MaxIdleConnsPerHost
+	if dial := tunnelDialer(); dial != nil {
+		tr.DialContext = dial
+	}
+	if !useHTTP2 {
+		// A non-nil, empty map keeps the transport from upgrading to
+		// HTTP/2.
+		tr.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	if proxyURL != "" {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			fatal("error parsing proxy url", "proxy", proxyURL, "err", err)
+		}
+		tr.Proxy = http.ProxyURL(u)
+	}
+	minVersion, ok := tlsVersions[tlsMin]
+	if !ok {
+		fatal("unknown -tls-min-version", "tls_min_version", tlsMin)
 	}
+	tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: insecure, MinVersion: minVersion}
+	if caCert != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := ioutil.ReadFile(caCert)
+		if err != nil {
+			fatal("error reading CA certificates", "ca_cert", caCert, "err", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			fatal("no certificates found", "ca_cert", caCert)
+		}
+		tr.TLSClientConfig.RootCAs = pool
+	}
+	if clientCert != "" {
+		key := clientKey
+		if key == "" {
+			key = clientCert
+		}
+		cert, err := tls.LoadX509KeyPair(clientCert, key)
+		if err != nil {
+			fatal("error loading client certificate", "client_cert", clientCert, "err", err)
+		}
+		tr.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	} else if clientKey != "" {
+		fatal("-client-key requires -client-cert")
+	}
+	var base http.RoundTripper = tr
+	if tracer != nil {
+		base = &tracingTransport{Base: base}
+	}
+	var onWait func(time.Duration)
+	if metricsListen != "" {
+		base = &metricsTransport{Base: base}
+		onWait = metrics.wait
+	}
+	if verbose || vverbose {
+		base = &gitlabtags.LogTransport{Base: base, Logger: slog.Default(), Headers: vverbose}
+	}
+	var rt http.RoundTripper = &gitlabtags.RetryTransport{
+		Base:       &gitlabtags.RateLimitTransport{Base: base, MaxRPS: maxRPS, OnWait: onWait},
+		Retries:    retries,
+		Backoff:    retryWait,
+		MaxBackoff: time.Minute,
+		Jitter:     jitter,
+	}
+	if cachePath != "" && (etagCache || cacheTTL > 0) {
+		rt = &gitlabtags.CacheTransport{Base: rt, Dir: cachePath, TTL: cacheTTL, Revalidate: etagCache}
+	}
+	if showProgress() {
+		startProgress()
+		rt = &progressTransport{Base: rt}
+	}
+	return &http.Client{Transport: rt}
+}
 
-	tr := &http.Transport{}
-	if insecure {
-		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+// tlsVersions are the values of -tls-min-version.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// maxIdleConns returns the number of idle connections to keep open to the
+// server: -max-idle-conns, or by default as many as there may be requests at
+// once, so that concurrent scans reuse their connections rather than opening
+// new ones for each request.
+func maxIdleConns() int {
+	if idleConns > 0 {
+		return idleConns
+	}
+	n := pageJobs
+	if concurrency > 1 {
+		n *= concurrency
+	}
+	if n < 2 {
+		n = 2
 	}
+	return n
+}
 
-	client := &http.Client{Transport: tr}
+// cacheDir returns the default directory responses are cached in, or an empty
+// string if the user has no cache directory.
+func cacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "gitlab-list-tags")
+}
 
-	req, err := http.NewRequest("GET", url.String(), nil)
+// readToken sets token from the file given by -token-file or from stdin if
+// -token-stdin is set, so that it need not appear in the process arguments.
+func readToken() {
+	var (
+		b   []byte
+		err error
+	)
+	switch {
+	case tokenFile != "" && tokenStdin:
+		fatal("only one of -token-file and -token-stdin may be given")
+	case tokenFile != "":
+		b, err = ioutil.ReadFile(tokenFile)
+	case tokenStdin:
+		b, err = ioutil.ReadAll(os.Stdin)
+	default:
+		return
+	}
 	if err != nil {
-		log.Fatalf("error creating request for url %s: %s", url.String(), err)
+		fatal("error reading token", "err", err)
 	}
-	req.Header.Add("PRIVATE-TOKEN", token)
+	token = strings.TrimSpace(string(b))
+}
 
-	resp, err := client.Do(req)
+// hostURL returns the base URL of the git host, which for Bitbucket Cloud need
+// not be given.
+func hostURL() string {
+	if baseURL == "" && provider == "bitbucket-cloud" {
+		return gitlabtags.BitbucketCloudURL
+	}
+	return baseURL
+}
+
+// listTags lists the project's tags according to the selection flags,
+// exiting if they cannot be retrieved.
+func listTags(ctx context.Context, client gitlabtags.Provider) (gitlabtags.Tags, []error) {
+	tags, parseErrs, err := tryListTags(ctx, client)
+	prog.clear()
 	if err != nil {
-		log.Fatalf("error getting url %s: %s", url.String(), err)
+		exitIfInterrupted(ctx)
+		fatal("error listing tags", "project", project(), "err", err)
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	return tags, parseErrs
+}
+
+// tryListTags is like listTags, but returns the error if the tags cannot be
+// retrieved. Invalid flags are still fatal.
+func tryListTags(ctx context.Context, client gitlabtags.Provider) (gitlabtags.Tags, []error, error) {
+	tags, parseErrs, err := client.ListTags(ctx, project(), listOptions())
 	if err != nil {
-		log.Fatalf("error reading response body for url %s: %s", url.String(), err)
+		return nil, nil, err
 	}
+	return selectNew(tags), parseErrs, nil
+}
 
-	// Check that the response is valid JSON array.
-	if !bytes.HasPrefix(body, []byte("[")) || !bytes.HasSuffix(body, []byte("]")) {
-		log.Fatalf("response was not valid; if this is a private repo, did you specify a token?\nResponse: %s", string(body))
+// selectNew returns the tags of the current project to print: with
+// -only-new, those newer than the latest seen before, and otherwise all of
+// them, collapsed with -dedupe-commits, up to -limit.
+func selectNew(tags gitlabtags.Tags) gitlabtags.Tags {
+	if onlyNew {
+		tags = newTags(tags)
+	}
+	if dedupe {
+		tags = gitlabtags.DedupeCommits(tags)
 	}
+	if (onlyNew || dedupe) && limit > 0 && len(tags) > limit {
+		tags = tags[:limit]
+	}
+	return tags
+}
 
-	var jsonResp []Tag
-	err = json.Unmarshal(body, &jsonResp)
+// streamTags writes the selected tags with printer as each page of them is
+// retrieved, if the provider and the selection flags allow it, returning how
+// many were written and the parse errors. It reports false, having written
+// nothing, if they cannot be streamed.
+func streamTags(ctx context.Context, client gitlabtags.Provider, printer func(io.Writer, gitlabtags.Tags) error) (int, []error, bool) {
+	s, ok := client.(gitlabtags.TagStreamer)
+	if !ok || onlyNew || dedupe {
+		return 0, nil, false
+	}
+	n := 0
+	parseErrs, err := s.StreamTags(ctx, project(), listOptions(), func(tags gitlabtags.Tags) error {
+		if err := printer(out, tags); err != nil {
+			fatal("error writing output", "output", output, "err", err)
+		}
+		n += len(tags)
+		return nil
+	})
+	if errors.Is(err, gitlabtags.ErrNotSupported) && n == 0 {
+		return 0, nil, false
+	}
 	if err != nil {
-		log.Fatalf("error decoding json for url %s: %s", url.String(), err)
+		exitIfInterrupted(ctx)
+		fatal("error listing tags", "project", project(), "err", err)
 	}
+	return n, parseErrs, true
+}
 
-	var errors string
-	var tags = make(Tags, len(jsonResp))
-	for i, tag := range jsonResp {
-		t := Tag{
-			Name:    tag.Name,
-			Message: tag.Message,
+// listOptions returns the options for listing the tags chosen by the
+// selection flags. Invalid flags are fatal.
+func listOptions() gitlabtags.ListOptions {
+	if onlyNew && !sortSemver {
+		fatal("-only-new requires -sort-semver")
+	}
+	checkNotify()
+	// Commands without the selection flags leave sortKey empty.
+	if sortKey != "" && sortKey != "semver" && sortKey != "date" && sortKey != "name" {
+		fatal("unknown sort order", "sort", sortKey)
+	}
+	if order != "" && order != "asc" && order != "desc" {
+		fatal("unknown sort direction", "order", order)
+	}
+	switch {
+	case orderBy != "" && orderBy != "name" && orderBy != "updated" && orderBy != "version":
+		fatal("unknown -order-by", "order_by", orderBy)
+	case orderBy != "" && (sortKey == "date" || sortKey == "name"):
+		fatal("-order-by cannot be used with -sort date or -sort name", "sort", sortKey)
+	case orderBy != "" && releases:
+		fatal("-order-by cannot be used with -releases")
+	}
+	// The default, 0.0.0, is not a version under every scheme, and selects
+	// all of them under any.
+	var sinceVers semver.Version
+	var err error
+	if since != "0.0.0" {
+		if sinceVers, err = versionParser()(since); err != nil {
+			fatal("unable to parse since version", "since_tag", since, "err", err)
+		}
+	}
+	var matchRE *regexp.Regexp
+	if match != "" {
+		if matchRE, err = regexp.Compile(match); err != nil {
+			fatal("invalid -match pattern", "match", match, "err", err)
+		}
+	}
+	var excludeREs []*regexp.Regexp
+	for _, e := range excludes {
+		re, err := regexp.Compile(e)
+		if err != nil {
+			fatal("invalid -exclude pattern", "exclude", e, "err", err)
 		}
-		if sortSemver {
-			n := strings.Replace(tag.Name, "v", "", 1)
-			vers, err := semver.Make(n)
-			if err != nil {
-				errors += fmt.Sprintf("error parsing tag %s: %s\n\n", tag.Name, err)
-			} else {
-				t.Version = vers
-			}
+		excludeREs = append(excludeREs, re)
+	}
+	var untilVers semver.Version
+	if until != "" {
+		if untilVers, err = versionParser()(until); err != nil {
+			fatal("unable to parse until version", "until_tag", until, "err", err)
 		}
-		tags[i] = t
 	}
 
-	if sortSemver {
-		sort.Sort(tags)
+	// -sort name is for tags that are not versions, so versions are only
+	// parsed, and the tags that are not reported, for the flags selecting
+	// tags by version. Without -sort-semver, the tags are sorted by name
+	// too, unless the host sorts them.
+	stable := stableOnly || (sortKey != "" && !includePre)
+	parse := sortSemver && (sortKey != "name" || since != "0.0.0" || until != "" || stable)
+	byName := sortKey == "name" || (!sortSemver && sortKey == "semver" && orderBy == "")
+
+	// With -only-new or -dedupe-commits the limit applies to the new or
+	// collapsed tags, so it is applied here rather than by ListTags.
+	opts := gitlabtags.ListOptions{
+		MaxTags:       maxTags,
+		TagPrefix:     tagPrefix,
+		StripPrefixes: stripPrefixes(),
+		Search:        search,
+		Match:         matchRE,
+		Exclude:       excludeREs,
+		SortSemver:    parse,
+		SortByDate:    sortKey == "date",
+		SortByName:    byName,
+		AnnotatedOnly: annotated,
+		Ascending:     order == "asc",
+		OrderBy:       orderBy,
+		Since:         sinceVers,
+		Until:         untilVers,
+		StableOnly:    stable,
+		ParseVersion:  versionParser(),
+		Concurrency:   pageJobs,
+		MemoryTags:    memoryTags,
+		Releases:      releases,
+		Signatures:    signatures || reqSigned,
+	}
+	if !onlyNew && !dedupe {
+		opts.Limit = limit
 	}
+	return opts
+}
 
+// versionParser returns the parser of the versions in tag names, and of the
+// versions given to compare them with: VersionRegex with -version-regex,
+// ParseCalVer with -version-scheme calver, CoerceVersion with
+// -coerce-versions, and otherwise semver.Make. Commands without the selection
+// flags leave scheme empty.
+func versionParser() gitlabtags.VersionParser {
+	switch {
+	case versionRE != "":
+		re, err := regexp.Compile("^(?:" + versionRE + ")$")
+		switch {
+		case err != nil:
+			fatal("invalid -version-regex", "version_regex", versionRE, "err", err)
+		case re.NumSubexp() == 0:
+			fatal("-version-regex has no capture groups", "version_regex", versionRE)
+		}
+		return gitlabtags.VersionRegex(re)
+	case scheme == "calver":
+		return gitlabtags.ParseCalVer
+	case scheme != "" && scheme != "semver":
+		fatal("unknown -version-scheme", "version_scheme", scheme)
+	case coerce:
+		return gitlabtags.CoerceVersion
+	}
+	return semver.Make
+}
+
+// parseTagVersions sets the versions of tags, as ListTags does with the
+// selection flags.
+func parseTagVersions(tags gitlabtags.Tags) []error {
+	return gitlabtags.ParseVersionsWith(tags, tagPrefix, stripPrefixes(), versionParser())
+}
+
+// stripPrefixes returns the prefixes given by -strip-prefixes, or nil for the
+// default if the command has no selection flags.
+func stripPrefixes() []string {
+	if sortKey == "" {
+		return nil
+	}
+	prefixes := []string{}
+	for _, p := range strings.Split(stripPre, ",") {
+		if p != "" {
+			prefixes = append(prefixes, p)
+		}
+	}
+	return prefixes
+}
+
+// checkSigned returns a failure with exitInvalidTags, listing the offending
+// tags on stderr, if -require-signed is set and any of tags is not signed
+// with a verified signature.
+func checkSigned(tags gitlabtags.Tags) error {
+	if !reqSigned {
+		return nil
+	}
+	var unsigned []string
 	for _, tag := range tags {
-		if sortSemver {
-			if tag.Version.GTE(sinceVers) {
-				fmt.Printf("%s %s\n%s\n\n", namePrefix, tag.Name, tag.Message)
-			}
-		} else {
-			fmt.Printf("%s %s\n%s\n\n", namePrefix, tag.Name, tag.Message)
+		if !tag.Signature.Verified() {
+			unsigned = append(unsigned, tag.Name+" ("+tag.Signature.Status+")")
 		}
 	}
+	if len(unsigned) > 0 {
+		fmt.Fprintf(os.Stderr, "Tags without a verified signature:\n%s\n", strings.Join(unsigned, "\n"))
+		return &failure{exitInvalidTags, fmt.Sprintf("%d tags without a verified signature", len(unsigned))}
+	}
+	return nil
+}
+
+// exitIfInterrupted exits with the conventional status for SIGINT if ctx was
+// canceled by an interrupt, so an aborted run is not reported as an error.
+func exitIfInterrupted(ctx context.Context) {
+	if ctx.Err() == context.Canceled {
+		fmt.Fprintln(os.Stderr, "interrupted")
+		flushTraces(ctx.Err())
+		os.Exit(exitInterrupted)
+	}
+}
 
-	if errors != "" {
-		fmt.Fprintf(os.Stderr, "\n\nErrors parsing semver tags:\n%s", errors)
+// invalidTags counts the tags reported by printParseErrors, for -strict.
+var invalidTags int
+
+// exitIfStrict exits with exitInvalidTags if -strict is set and any tag was
+// not a semantic version.
+func exitIfStrict() {
+	if strict && invalidTags > 0 {
+		slog.Error("tags are not semantic versions", "count", invalidTags)
+		exit(&failure{exitInvalidTags, "tags are not semantic versions"})
 	}
+}
 
+// printParseErrors reports tags that could not be parsed as semantic versions
+// on stderr, unless -quiet is set.
+func printParseErrors(parseErrs []error) {
+	invalidTags += len(parseErrs)
+	if len(parseErrs) == 0 || quiet && !strict {
+		return
+	}
+	var errors string
+	for _, err := range parseErrs {
+		errors += err.Error() + "\n\n"
+	}
+	fmt.Fprintf(os.Stderr, "\n\nErrors parsing semver tags:\n%s", errors)
 }
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var manDir string
+
+// genManFlags registers the flags of the gen-man command on fs.
+func genManFlags(fs *flag.FlagSet) {
+	fs.StringVar(&manDir, "dir", ".", "Directory to write the man pages to")
+}
+
+// runGenMan writes the man page of gitlab-list-tags, gitlab-list-tags.1, and
+// one for each command, such as gitlab-list-tags-list.1, to -dir.
+func runGenMan(ctx context.Context, fs *flag.FlagSet) {
+	if err := os.MkdirAll(manDir, 0755); err != nil {
+		fatal("error writing man pages", "dir", manDir, "err", err)
+	}
+	pages := map[string][]byte{"gitlab-list-tags.1": mainManPage()}
+	for _, cmd := range commands {
+		if !cmd.hidden {
+			pages["gitlab-list-tags-"+cmd.name+".1"] = commandManPage(cmd)
+		}
+	}
+	for name, page := range pages {
+		if err := writeFileAtomic(filepath.Join(manDir, name), page); err != nil {
+			fatal("error writing man pages", "dir", manDir, "err", err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %d man pages to %s\n", len(pages), manDir)
+}
+
+// mainManPage returns the man page of gitlab-list-tags, listing its commands
+// and exit statuses.
+func mainManPage() []byte {
+	var b bytes.Buffer
+	manHeader(&b, "gitlab-list-tags")
+	fmt.Fprintf(&b, ".SH NAME\ngitlab\\-list\\-tags \\- list and publish the tags of GitLab projects\n")
+	fmt.Fprintf(&b, ".SH SYNOPSIS\n.B gitlab\\-list\\-tags\n[\\fIcommand\\fR] [\\fIflags\\fR]\n")
+	fmt.Fprintf(&b, ".SH DESCRIPTION\n%s\n", roff("gitlab-list-tags lists the tags of a GitLab project, or of a Bitbucket repository, and prints them as text, JSON, CSV, a changelog, or a feed. The list command is run if no command is given."))
+	fmt.Fprintf(&b, ".SH COMMANDS\n")
+	var seeAlso []string
+	for _, cmd := range commands {
+		if cmd.hidden {
+			continue
+		}
+		fmt.Fprintf(&b, ".TP\n.B %s\n%s.\nSee \\fB%s\\fR(1).\n", roff(cmd.name), roff(cmd.summary), roff("gitlab-list-tags-"+cmd.name))
+		seeAlso = append(seeAlso, "\\fB"+roff("gitlab-list-tags-"+cmd.name)+"\\fR(1)")
+	}
+	fmt.Fprintf(&b, ".SH EXIT STATUS\n")
+	for _, s := range []struct {
+		status int
+		desc   string
+	}{
+		{0, "Success."},
+		{exitError, "Any failure not listed below."},
+		{exitUsage, "Invalid command line."},
+		{exitNoTags, "No tags matched the selection flags, except with -only-new."},
+		{exitNotFound, "The project, or another resource, was not found."},
+		{exitAuth, "The token is missing, invalid, or lacks access."},
+		{exitNetwork, "The host could not be reached."},
+		{exitInvalidTags, "Some tags failed a check: -strict, -require-signed, or the check command."},
+		{exitInterrupted, "Interrupted by SIGINT or SIGTERM."},
+	} {
+		fmt.Fprintf(&b, ".TP\n.B %d\n%s\n", s.status, roff(s.desc))
+	}
+	fmt.Fprintf(&b, ".SH SEE ALSO\n%s\n", strings.Join(seeAlso, ",\n"))
+	return b.Bytes()
+}
+
+// commandManPage returns the man page of cmd, describing its flags.
+func commandManPage(cmd *command) []byte {
+	var b bytes.Buffer
+	manHeader(&b, "gitlab-list-tags-"+cmd.name)
+	fmt.Fprintf(&b, ".SH NAME\n%s \\- %s\n", roff("gitlab-list-tags-"+cmd.name), roff(strings.ToLower(cmd.summary[:1])+cmd.summary[1:]))
+	fmt.Fprintf(&b, ".SH SYNOPSIS\n.B gitlab\\-list\\-tags %s\n", roff(cmd.name))
+	if cmd.flags != nil {
+		fmt.Fprintf(&b, "[\\fIflags\\fR]")
+		if cmd.args != "" {
+			b.WriteString(" ")
+		}
+	}
+	if cmd.args != "" {
+		fmt.Fprintf(&b, "\\fI%s\\fR", roff(cmd.args))
+	}
+	if cmd.flags != nil || cmd.args != "" {
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, ".SH DESCRIPTION\n%s.\n", roff(cmd.summary))
+	if flags := commandFlags(cmd); len(flags) > 0 {
+		fmt.Fprintf(&b, ".SH OPTIONS\n")
+		for _, f := range flags {
+			name, usage := flag.UnquoteUsage(f)
+			fmt.Fprintf(&b, ".TP\n\\fB\\-%s\\fR", roff(f.Name))
+			if name != "" {
+				fmt.Fprintf(&b, " \\fI%s\\fR", roff(name))
+			}
+			b.WriteString("\n" + roff(usage))
+			if !zeroDefault(f.DefValue) {
+				fmt.Fprintf(&b, " (default %s)", roff(homeRelative(f.DefValue)))
+			}
+			b.WriteString("\n")
+		}
+	}
+	fmt.Fprintf(&b, ".SH SEE ALSO\n\\fBgitlab\\-list\\-tags\\fR(1)\n")
+	return b.Bytes()
+}
+
+// manHeader writes the title line of the man page called name. It has no
+// date, so that the pages are the same each time they are generated.
+func manHeader(b *bytes.Buffer, name string) {
+	fmt.Fprintf(b, ".TH %s 1 \"\" \"gitlab\\-list\\-tags %s\" \"User Commands\"\n", roff(strings.ToUpper(name)), roff(version))
+}
+
+// zeroDefault reports whether a flag's default value is the zero value of
+// its type, which the flag package also leaves out of the usage.
+func zeroDefault(v string) bool {
+	switch v {
+	case "", "false", "0", "0s", "[]":
+		return true
+	}
+	return false
+}
+
+// homeRelative returns path with the user's home directory replaced by ~, so
+// that defaults such as the cache directory are the same whoever generates
+// the pages.
+func homeRelative(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" || !strings.HasPrefix(path, home+string(filepath.Separator)) {
+		return path
+	}
+	return "~" + path[len(home):]
+}
+
+// roff escapes s for use in the text of a man page.
+func roff(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		if strings.HasPrefix(l, ".") || strings.HasPrefix(l, "'") {
+			lines[i] = `\&` + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
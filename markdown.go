@@ -0,0 +1,484 @@
+package main
+
+import (
+	"flag"
+	"html"
+	"net/url"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+var renderMD bool
+
+// markdownFlag registers the flag rendering tag messages as markdown on fs.
+func markdownFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&renderMD, "render-markdown", false, "Render tag messages from GitLab Flavored Markdown rather than printing the raw markup: as plain text in text output, styled with ANSI escapes on a terminal, and as HTML in html and atom output")
+}
+
+// mdFormat is what markdown is rendered into.
+type mdFormat int
+
+const (
+	mdPlain mdFormat = iota
+	mdANSI
+	mdHTML
+)
+
+// textMessage returns message as printed in text output: rendered with
+// -render-markdown, styled if the output is a terminal that may be styled,
+// and otherwise as it is. The Windows console only understands ANSI escapes
+// once asked to, so it gets plain text.
+func textMessage(message string) string {
+	if !renderMD {
+		return message
+	}
+	f := mdPlain
+	if out == os.Stdout && isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb" && runtime.GOOS != "windows" {
+		f = mdANSI
+	}
+	return renderMarkdown(message, f)
+}
+
+// renderMarkdown renders the markdown text into f. In ANSI and HTML, where
+// links need not be spelled out, its issue references are linked as in
+// changelogs.
+func renderMarkdown(text string, f mdFormat) string {
+	if f != mdPlain {
+		text = linkIssueRefs(text)
+	}
+	return renderBlocks(parseMarkdown(text), f)
+}
+
+// mdKind is the kind of an mdBlock.
+type mdKind int
+
+const (
+	mdParagraph mdKind = iota
+	mdHeading
+	mdList
+	mdCode
+	mdQuote
+	mdRule
+)
+
+// mdBlock is a block of a markdown document.
+type mdBlock struct {
+	kind  mdKind
+	level int      // of a heading
+	lines []string // of a paragraph, heading, or code block, or the markdown quoted
+	items []mdItem // of a list
+}
+
+// mdItem is an item of a list.
+type mdItem struct {
+	depth   int    // 0 for the items of the outermost list
+	indent  int    // columns before the marker
+	marker  string // such as "-" or "1."
+	ordered bool
+	lines   []string
+}
+
+var (
+	mdHeadingRE = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	mdRuleRE    = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	mdFenceRE   = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+	mdQuoteRE   = regexp.MustCompile(`^ {0,3}> ?(.*)$`)
+	mdItemRE    = regexp.MustCompile(`^([ \t]*)([-*+]|\d{1,9}[.)])(?:[ \t]+(.*)|$)`)
+)
+
+// parseMarkdown splits text into its blocks. It understands the markdown
+// commonly written in tag messages and release notes, rather than every
+// corner of CommonMark: ATX headings, paragraphs, nested lists, fenced and
+// indented code blocks, block quotes, and rules.
+func parseMarkdown(text string) []mdBlock {
+	lines := strings.Split(strings.Replace(strings.TrimRight(text, "\n"), "\r\n", "\n", -1), "\n")
+	var blocks []mdBlock
+	var para []string
+	flush := func() {
+		if len(para) > 0 {
+			blocks = append(blocks, mdBlock{kind: mdParagraph, lines: para})
+			para = nil
+		}
+	}
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+
+		case mdFenceRE.MatchString(line):
+			flush()
+			fence := mdFenceRE.FindStringSubmatch(line)[1]
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			blocks = append(blocks, mdBlock{kind: mdCode, lines: code})
+
+		case len(para) == 0 && (strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t")):
+			var code []string
+			for ; i < len(lines); i++ {
+				l := lines[i]
+				if strings.TrimSpace(l) != "" && !strings.HasPrefix(l, "    ") && !strings.HasPrefix(l, "\t") {
+					break
+				}
+				if strings.HasPrefix(l, "\t") {
+					l = l[1:]
+				} else if len(l) >= 4 {
+					l = l[4:]
+				}
+				code = append(code, l)
+			}
+			i--
+			for len(code) > 0 && strings.TrimSpace(code[len(code)-1]) == "" {
+				code = code[:len(code)-1]
+			}
+			blocks = append(blocks, mdBlock{kind: mdCode, lines: code})
+
+		case mdHeadingRE.MatchString(line):
+			flush()
+			m := mdHeadingRE.FindStringSubmatch(line)
+			blocks = append(blocks, mdBlock{kind: mdHeading, level: len(m[1]), lines: []string{m[2]}})
+
+		case mdRuleRE.MatchString(line):
+			flush()
+			blocks = append(blocks, mdBlock{kind: mdRule})
+
+		case mdQuoteRE.MatchString(line):
+			flush()
+			var quoted []string
+			for ; i < len(lines); i++ {
+				m := mdQuoteRE.FindStringSubmatch(lines[i])
+				if m == nil {
+					break
+				}
+				quoted = append(quoted, m[1])
+			}
+			i--
+			blocks = append(blocks, mdBlock{kind: mdQuote, lines: quoted})
+
+		case mdItemRE.MatchString(line):
+			flush()
+			var items []mdItem
+			for ; i < len(lines); i++ {
+				l := lines[i]
+				if m := mdItemRE.FindStringSubmatch(l); m != nil && !mdRuleRE.MatchString(l) {
+					_, err := strconv.Atoi(strings.TrimRight(m[2], ".)"))
+					it := mdItem{indent: indentWidth(m[1]), marker: m[2], ordered: err == nil, lines: []string{m[3]}}
+					// A bullet after a numbered item, or the other way round,
+					// starts another list unless it is nested.
+					if len(items) > 0 && it.ordered != items[0].ordered && it.indent <= items[0].indent {
+						break
+					}
+					items = append(items, it)
+					continue
+				}
+				if strings.TrimSpace(l) == "" {
+					// A blank line between items does not end the list.
+					if i+1 < len(lines) && mdItemRE.MatchString(lines[i+1]) && !mdRuleRE.MatchString(lines[i+1]) {
+						continue
+					}
+					break
+				}
+				if mdFenceRE.MatchString(l) || mdHeadingRE.MatchString(l) || mdRuleRE.MatchString(l) || mdQuoteRE.MatchString(l) {
+					break
+				}
+				last := &items[len(items)-1]
+				last.lines = append(last.lines, strings.TrimSpace(l))
+			}
+			i--
+			nestItems(items)
+			blocks = append(blocks, mdBlock{kind: mdList, items: items})
+
+		default:
+			para = append(para, strings.TrimSpace(line))
+		}
+	}
+	flush()
+	return blocks
+}
+
+// indentWidth returns the width of the indentation s, with tabs to multiples of
+// four columns.
+func indentWidth(s string) int {
+	n := 0
+	for _, c := range s {
+		if c == '\t' {
+			n += 4 - n%4
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// nestItems sets the depth of each of items from its indentation: an item
+// indented further than the one before it starts a list nested in it, and
+// one indented less ends the lists nested deeper than it.
+func nestItems(items []mdItem) {
+	var indents []int
+	for i := range items {
+		for len(indents) > 0 && indents[len(indents)-1] > items[i].indent {
+			indents = indents[:len(indents)-1]
+		}
+		if len(indents) == 0 || items[i].indent > indents[len(indents)-1] {
+			indents = append(indents, items[i].indent)
+		}
+		items[i].depth = len(indents) - 1
+	}
+}
+
+// renderBlocks renders blocks into f.
+func renderBlocks(blocks []mdBlock, f mdFormat) string {
+	rendered := make([]string, 0, len(blocks))
+	for _, blk := range blocks {
+		rendered = append(rendered, renderBlock(blk, f))
+	}
+	if f == mdHTML {
+		return strings.Join(rendered, "\n")
+	}
+	return strings.Join(rendered, "\n\n")
+}
+
+// renderBlock renders blk into f.
+func renderBlock(blk mdBlock, f mdFormat) string {
+	switch blk.kind {
+	case mdHeading:
+		text := renderInline(blk.lines[0], f)
+		switch f {
+		case mdHTML:
+			// The page's own headings are h1 and h2.
+			level := blk.level + 2
+			if level > 6 {
+				level = 6
+			}
+			return "<h" + strconv.Itoa(level) + ">" + text + "</h" + strconv.Itoa(level) + ">"
+		case mdANSI:
+			if blk.level == 1 {
+				return "\x1b[1;4m" + text + "\x1b[0m"
+			}
+			return "\x1b[1m" + text + "\x1b[0m"
+		}
+		return text
+
+	case mdList:
+		return renderList(blk.items, f)
+
+	case mdCode:
+		switch f {
+		case mdHTML:
+			return "<pre><code>" + html.EscapeString(strings.Join(blk.lines, "\n")) + "</code></pre>"
+		case mdANSI:
+			return "    \x1b[36m" + strings.Join(blk.lines, "\x1b[39m\n    \x1b[36m") + "\x1b[39m"
+		}
+		return "    " + strings.Join(blk.lines, "\n    ")
+
+	case mdQuote:
+		inner := renderBlocks(parseMarkdown(strings.Join(blk.lines, "\n")), f)
+		switch f {
+		case mdHTML:
+			return "<blockquote>\n" + inner + "\n</blockquote>"
+		case mdANSI:
+			return "\x1b[2m│\x1b[22m " + strings.Replace(inner, "\n", "\n\x1b[2m│\x1b[22m ", -1)
+		}
+		return "> " + strings.Replace(inner, "\n", "\n> ", -1)
+
+	case mdRule:
+		switch f {
+		case mdHTML:
+			return "<hr>"
+		case mdANSI:
+			return "\x1b[2m" + strings.Repeat("─", 40) + "\x1b[22m"
+		}
+		return strings.Repeat("-", 40)
+	}
+
+	if f == mdHTML {
+		return "<p>" + renderInline(strings.Join(blk.lines, "\n"), f) + "</p>"
+	}
+	lines := make([]string, len(blk.lines))
+	for i, l := range blk.lines {
+		lines[i] = renderInline(l, f)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renderList renders the items of a list into f, nesting them by depth.
+func renderList(items []mdItem, f mdFormat) string {
+	var b strings.Builder
+	if f != mdHTML {
+		for i, it := range items {
+			marker := it.marker
+			if !it.ordered {
+				marker = "-"
+				if f == mdANSI {
+					marker = "•"
+				}
+			}
+			indent := strings.Repeat("  ", it.depth)
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			b.WriteString(indent + marker + " " + renderInline(it.lines[0], f))
+			for _, l := range it.lines[1:] {
+				b.WriteString("\n" + indent + strings.Repeat(" ", len(it.marker)+1) + renderInline(l, f))
+			}
+		}
+		return b.String()
+	}
+
+	var open []string // the lists open, innermost last
+	for i, it := range items {
+		if i > 0 {
+			for len(open) > it.depth+1 {
+				b.WriteString("</li>\n</" + open[len(open)-1] + ">\n")
+				open = open[:len(open)-1]
+			}
+			if len(open) == it.depth+1 {
+				b.WriteString("</li>\n")
+			}
+		}
+		for len(open) < it.depth+1 {
+			tag := "ul"
+			if it.ordered {
+				tag = "ol"
+			}
+			if len(open) > 0 {
+				b.WriteString("\n")
+			}
+			b.WriteString("<" + tag + ">\n")
+			open = append(open, tag)
+		}
+		b.WriteString("<li>" + renderInline(strings.Join(it.lines, "\n"), f))
+	}
+	for len(open) > 0 {
+		b.WriteString("</li>\n</" + open[len(open)-1] + ">")
+		if open = open[:len(open)-1]; len(open) > 0 {
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// The destination of a link may hold balanced parentheses, one level deep, as
+// in https://en.wikipedia.org/wiki/Go_(language).
+var (
+	mdCodeSpanRE = regexp.MustCompile("``(.+?)``|`([^`]+)`")
+	mdEscapeRE   = regexp.MustCompile(`\\([!"#$%&'()*+,\-./:;<=>?@\[\\\]^_` + "`" + `{|}~])`)
+	mdLinkRE     = regexp.MustCompile(`(!?)\[([^\]]*)\]\(<?((?:[^()\s<>]|\([^()\s<>]*\))+)>?(?:[ \t]+"[^"]*")?\)`)
+	mdAutolinkRE = regexp.MustCompile(`<((?:https?|ftp)://[^>\s]+|mailto:[^>\s]+)>`)
+	mdStrongRE   = regexp.MustCompile(`\*\*([^*\s](?:[^*]*[^*\s])?)\*\*|\b__([^_\s](?:[^_]*[^_\s])?)__\b`)
+	mdEmRE       = regexp.MustCompile(`\*([^*\s](?:[^*]*[^*\s])?)\*|\b_([^_\s](?:[^_]*[^_\s])?)_\b`)
+	mdStrikeRE   = regexp.MustCompile(`~~([^~\s](?:[^~]*[^~\s])?)~~`)
+	mdSlotRE     = regexp.MustCompile("\x00([0-9]+)\x00")
+)
+
+// renderInline renders the code spans, escapes, links, and emphasis of the
+// markdown text into f. Code spans, escapes, and links are rendered first
+// and set aside in slots, so that the markup in them is left alone.
+func renderInline(text string, f mdFormat) string {
+	var slots []string
+	slot := func(s string) string {
+		slots = append(slots, s)
+		return "\x00" + strconv.Itoa(len(slots)-1) + "\x00"
+	}
+	escape := func(s string) string {
+		if f == mdHTML {
+			return html.EscapeString(s)
+		}
+		return s
+	}
+	text = strings.Replace(text, "\x00", "", -1)
+
+	text = mdCodeSpanRE.ReplaceAllStringFunc(text, func(s string) string {
+		m := mdCodeSpanRE.FindStringSubmatch(s)
+		code := strings.TrimSpace(m[1] + m[2])
+		switch f {
+		case mdHTML:
+			return slot("<code>" + html.EscapeString(code) + "</code>")
+		case mdANSI:
+			return slot("\x1b[36m" + code + "\x1b[39m")
+		}
+		return slot(code)
+	})
+	text = mdEscapeRE.ReplaceAllStringFunc(text, func(s string) string {
+		return slot(escape(s[1:]))
+	})
+	text = mdAutolinkRE.ReplaceAllStringFunc(text, func(s string) string {
+		u := s[1 : len(s)-1]
+		if f == mdHTML {
+			return slot(`<a href="` + html.EscapeString(u) + `">` + html.EscapeString(u) + "</a>")
+		}
+		return slot(u)
+	})
+	text = mdLinkRE.ReplaceAllStringFunc(text, func(s string) string {
+		m := mdLinkRE.FindStringSubmatch(s)
+		image, label, u := m[1] == "!", m[2], m[3]
+		if f == mdHTML {
+			if !safeURL(u) {
+				return slot(renderInline(label, f))
+			}
+			if image {
+				return slot(`<img src="` + html.EscapeString(u) + `" alt="` + html.EscapeString(label) + `">`)
+			}
+			return slot(`<a href="` + html.EscapeString(u) + `">` + renderInline(label, f) + "</a>")
+		}
+		label = renderInline(label, f)
+		if f == mdANSI && label != "" {
+			label = "\x1b[4m" + label + "\x1b[24m"
+		}
+		switch {
+		case label == "":
+			return slot(u)
+		case m[2] == u:
+			return slot(label)
+		}
+		return slot(label + " (" + u + ")")
+	})
+
+	text = escape(text)
+	text = mdStrongRE.ReplaceAllStringFunc(text, func(s string) string {
+		m := mdStrongRE.FindStringSubmatch(s)
+		return emphasize(m[1]+m[2], f, "strong", "\x1b[1m", "\x1b[22m")
+	})
+	text = mdStrikeRE.ReplaceAllStringFunc(text, func(s string) string {
+		return emphasize(mdStrikeRE.FindStringSubmatch(s)[1], f, "del", "\x1b[9m", "\x1b[29m")
+	})
+	text = mdEmRE.ReplaceAllStringFunc(text, func(s string) string {
+		m := mdEmRE.FindStringSubmatch(s)
+		return emphasize(m[1]+m[2], f, "em", "\x1b[3m", "\x1b[23m")
+	})
+	return mdSlotRE.ReplaceAllStringFunc(text, func(s string) string {
+		n, _ := strconv.Atoi(s[1 : len(s)-1])
+		return slots[n]
+	})
+}
+
+// emphasize returns text wrapped in the HTML element tag, or the ANSI escapes
+// on and off, as f asks.
+func emphasize(text string, f mdFormat, tag, on, off string) string {
+	switch f {
+	case mdHTML:
+		return "<" + tag + ">" + text + "</" + tag + ">"
+	case mdANSI:
+		return on + text + off
+	}
+	return text
+}
+
+// safeURL reports whether u may be linked to from HTML: whether it is
+// relative, or an http, https, ftp, or mailto URL, rather than a script.
+func safeURL(u string) bool {
+	p, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(p.Scheme) {
+	case "", "http", "https", "ftp", "mailto":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/jgoodall/gitlab-list-tags/pkg/gitlabtags"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		f    mdFormat
+		want string
+	}{
+		{"inline plain", "# Title\n\nSome *em* and **strong** and ~~gone~~ and `co*de*`.", mdPlain,
+			"Title\n\nSome em and strong and gone and co*de*."},
+		{"inline ansi", "# Title\n\nSome *em* and **strong** and ~~gone~~ and `co*de*`.", mdANSI,
+			"\x1b[1;4mTitle\x1b[0m\n\nSome \x1b[3mem\x1b[23m and \x1b[1mstrong\x1b[22m and \x1b[9mgone\x1b[29m and \x1b[36mco*de*\x1b[39m."},
+		{"inline html", "# Title\n\nSome *em* and **strong** and ~~gone~~ and `co*de*`.", mdHTML,
+			"<h3>Title</h3>\n<p>Some <em>em</em> and <strong>strong</strong> and <del>gone</del> and <code>co*de*</code>.</p>"},
+		{"lists plain", "- one\n- two\n  - nested\n- three\n\n1. first\n2. second", mdPlain,
+			"- one\n- two\n  - nested\n- three\n\n1. first\n2. second"},
+		{"lists ansi", "* one\n* two\n  * nested", mdANSI,
+			"• one\n• two\n  • nested"},
+		{"lists html", "- one\n- two\n  - nested\n- three\n\n1. first\n2. second", mdHTML,
+			"<ul>\n<li>one</li>\n<li>two\n<ul>\n<li>nested</li>\n</ul>\n</li>\n<li>three</li>\n</ul>\n<ol>\n<li>first</li>\n<li>second</li>\n</ol>"},
+		{"bullets then numbers", "- a\n1. b", mdPlain,
+			"- a\n\n1. b"},
+		{"blocks plain", "```\ncode <b>\n```\n\n    indented\n\n> quoted *text*\n\n---", mdPlain,
+			"    code <b>\n\n    indented\n\n> quoted text\n\n" + "----------------------------------------"},
+		{"blocks html", "```\ncode <b>\n```\n\n    indented\n\n> quoted *text*\n\n---", mdHTML,
+			"<pre><code>code &lt;b&gt;</code></pre>\n<pre><code>indented</code></pre>\n<blockquote>\n<p>quoted <em>text</em></p>\n</blockquote>\n<hr>"},
+		{"links plain", "[Go](https://en.wikipedia.org/wiki/Go_(language)) ![img](http://x/i.png) <https://a.example/> [https://b.example/](https://b.example/)", mdPlain,
+			"Go (https://en.wikipedia.org/wiki/Go_(language)) img (http://x/i.png) https://a.example/ https://b.example/"},
+		{"links html", "[Go](https://en.wikipedia.org/wiki/Go_(language)) ![img](http://x/i.png) <https://a.example/>", mdHTML,
+			`<p><a href="https://en.wikipedia.org/wiki/Go_(language)">Go</a> <img src="http://x/i.png" alt="img"> <a href="https://a.example/">https://a.example/</a></p>`},
+		{"link title", `[docs](https://d.example/ "The docs")`, mdPlain,
+			"docs (https://d.example/)"},
+		{"link in parentheses", "(see [x](http://a/b))", mdPlain,
+			"(see x (http://a/b))"},
+		{"unsafe link html", "[bad](javascript:alert(1))", mdHTML,
+			"<p>bad</p>"},
+		{"escapes and html", `\*not em\* a_b_c 5 < 6 & <b>`, mdHTML,
+			"<p>*not em* a_b_c 5 &lt; 6 &amp; &lt;b&gt;</p>"},
+		{"escapes plain", `\*not em\* a_b_c`, mdPlain,
+			"*not em* a_b_c"},
+		{"crlf", "one\r\ntwo\r\n", mdPlain,
+			"one\ntwo"},
+	}
+	for _, tt := range tests {
+		if got := renderMarkdown(tt.in, tt.f); got != tt.want {
+			t.Errorf("%s: renderMarkdown(%q) =\n%q\nwant\n%q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRenderMarkdownIssueRefs(t *testing.T) {
+	c, err := gitlabtags.NewClient("https://gitlab.example.com/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(c gitlabtags.Provider, link bool, o, r string) {
+		client, linkIssues, org, repo = c, link, o, r
+	}(client, linkIssues, org, repo)
+	client, linkIssues, org, repo = c, true, "g", "p"
+
+	tests := []struct {
+		f    mdFormat
+		want string
+	}{
+		{mdPlain, "Fixes #12 and g/q#3."},
+		{mdANSI, "Fixes \x1b[4m#12\x1b[24m (https://gitlab.example.com/g/p/-/issues/12) and \x1b[4mg/q#3\x1b[24m (https://gitlab.example.com/g/q/-/issues/3)."},
+		{mdHTML, `<p>Fixes <a href="https://gitlab.example.com/g/p/-/issues/12">#12</a> and <a href="https://gitlab.example.com/g/q/-/issues/3">g/q#3</a>.</p>`},
+	}
+	for _, tt := range tests {
+		if got := renderMarkdown("Fixes #12 and g/q#3.", tt.f); got != tt.want {
+			t.Errorf("format %d: got\n%q\nwant\n%q", tt.f, got, tt.want)
+		}
+	}
+}
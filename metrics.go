@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jgoodall/gitlab-list-tags/pkg/gitlabtags"
+)
+
+var metricsListen string
+
+// metricsFlag registers the flag serving metrics in the long-running modes,
+// -watch and serve-webhook, on fs.
+func metricsFlag(fs *flag.FlagSet) {
+	fs.StringVar(&metricsListen, "metrics-listen", "", "Address to serve Prometheus metrics on, at /metrics (e.g. :9100); none are served if empty")
+}
+
+// metrics are the counters and gauges served on /metrics.
+var metrics = &metricSet{
+	requests: map[int]int64{},
+	latest:   map[string]gitlabtags.Tag{},
+}
+
+// metricSet holds the metrics. It is safe for concurrent use.
+type metricSet struct {
+	mu sync.Mutex
+
+	requests  map[int]int64 // API responses, by status code
+	errors    int64         // API requests failing, or answered with an error status
+	waits     int64         // requests delayed by rate limiting
+	waitTotal time.Duration // time requests were delayed by rate limiting
+
+	latest map[string]gitlabtags.Tag // highest semantic version tag, by project
+}
+
+// request counts an API request that got resp, or failed with err.
+func (m *metricSet) request(resp *http.Response, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		m.errors++
+		return
+	}
+	m.requests[resp.StatusCode]++
+	if resp.StatusCode >= 400 {
+		m.errors++
+	}
+}
+
+// wait counts a request delayed by d to stay under the rate limits.
+func (m *metricSet) wait(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.waits++
+	m.waitTotal += d
+}
+
+// recordLatest records the highest semantic version among tags as project's
+// latest, unless a higher one was recorded before.
+func (m *metricSet) recordLatest(project string, tags gitlabtags.Tags) {
+	latest := latestTag(tags)
+	if latest == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if prev, ok := m.latest[project]; !ok || gitlabtags.CompareVersions(latest.Version, prev.Version) > 0 {
+		m.latest[project] = *latest
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *metricSet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	b := bufio.NewWriter(w)
+	defer b.Flush()
+
+	fmt.Fprintln(b, "# HELP gitlab_list_tags_api_requests_total API requests answered, by status code.")
+	fmt.Fprintln(b, "# TYPE gitlab_list_tags_api_requests_total counter")
+	codes := make([]int, 0, len(m.requests))
+	for code := range m.requests {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(b, "gitlab_list_tags_api_requests_total{code=\"%d\"} %d\n", code, m.requests[code])
+	}
+	fmt.Fprintln(b, "# HELP gitlab_list_tags_api_errors_total API requests that failed or were answered with an error status.")
+	fmt.Fprintln(b, "# TYPE gitlab_list_tags_api_errors_total counter")
+	fmt.Fprintf(b, "gitlab_list_tags_api_errors_total %d\n", m.errors)
+	fmt.Fprintln(b, "# HELP gitlab_list_tags_rate_limit_waits_total API requests delayed to stay under the rate limits.")
+	fmt.Fprintln(b, "# TYPE gitlab_list_tags_rate_limit_waits_total counter")
+	fmt.Fprintf(b, "gitlab_list_tags_rate_limit_waits_total %d\n", m.waits)
+	fmt.Fprintln(b, "# HELP gitlab_list_tags_rate_limit_wait_seconds_total Time API requests were delayed to stay under the rate limits.")
+	fmt.Fprintln(b, "# TYPE gitlab_list_tags_rate_limit_wait_seconds_total counter")
+	fmt.Fprintf(b, "gitlab_list_tags_rate_limit_wait_seconds_total %s\n", strconv.FormatFloat(m.waitTotal.Seconds(), 'f', -1, 64))
+
+	fmt.Fprintln(b, "# HELP gitlab_list_tags_latest_version_info The highest semantic version tag of each project, in its labels.")
+	fmt.Fprintln(b, "# TYPE gitlab_list_tags_latest_version_info gauge")
+	projects := make([]string, 0, len(m.latest))
+	for p := range m.latest {
+		projects = append(projects, p)
+	}
+	sort.Strings(projects)
+	for _, p := range projects {
+		tag := m.latest[p]
+		fmt.Fprintf(b, "gitlab_list_tags_latest_version_info{project=\"%s\",tag=\"%s\",version=\"%s\"} 1\n", labelValue(p), labelValue(tag.Name), labelValue(tag.Version.String()))
+	}
+}
+
+// labelValue escapes s for use as a label value in the Prometheus text
+// format.
+func labelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// metricsTransport is an http.RoundTripper that counts the requests it makes
+// and their errors in metrics.
+type metricsTransport struct {
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.Base.RoundTrip(req)
+	metrics.request(resp, err)
+	return resp, err
+}
+
+// serveMetrics serves the metrics on -metrics-listen, if it is set, until ctx
+// is done. Failing to listen is fatal.
+func serveMetrics(ctx context.Context) {
+	if metricsListen == "" {
+		return
+	}
+	l, err := net.Listen("tcp", metricsListen)
+	if err != nil {
+		fatal("error serving metrics", "metrics_listen", metricsListen, "err", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+	go func() {
+		if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("error serving metrics", "metrics_listen", metricsListen, "err", err)
+		}
+	}()
+	slog.Info("serving metrics", "metrics_listen", metricsListen, "path", "/metrics")
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// netrcFile returns the path of the user's .netrc file, which may be
+// overridden by the NETRC environment variable as with curl and git.
+func netrcFile() string {
+	if f := os.Getenv("NETRC"); f != "" {
+		return f
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// netrcToken returns the password for the host of rawURL in the user's .netrc
+// file, falling back to the default entry, or an empty string if there is
+// none.
+func netrcToken(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	file := netrcFile()
+	if file == "" {
+		return ""
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	return netrcPassword(string(b), u.Hostname())
+}
+
+// netrcPassword returns the password of the entry for host in the .netrc
+// data, or of the default entry if host has none.
+func netrcPassword(data, host string) string {
+	var (
+		machine         string
+		inEntry         bool
+		found, fallback string
+	)
+	lines := strings.Split(data, "\n")
+	for i := 0; i < len(lines); i++ {
+		fields := strings.Fields(lines[i])
+		for j := 0; j < len(fields); j++ {
+			switch fields[j] {
+			case "machine":
+				if j+1 < len(fields) {
+					machine, inEntry = fields[j+1], true
+					j++
+				}
+			case "default":
+				machine, inEntry = "", true
+			case "password":
+				if j+1 < len(fields) && inEntry {
+					if machine == host && found == "" {
+						found = fields[j+1]
+					} else if machine == "" && fallback == "" {
+						fallback = fields[j+1]
+					}
+					j++
+				}
+			case "macdef":
+				// A macro definition runs until the next blank line.
+				for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+					i++
+				}
+				j = len(fields)
+			default:
+				if strings.HasPrefix(fields[j], "#") {
+					j = len(fields)
+				}
+			}
+		}
+	}
+	if found != "" {
+		return found
+	}
+	return fallback
+}
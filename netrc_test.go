@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestNetrcPassword(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		host string
+		want string
+	}{
+		{"one line", "machine gitlab.example.com login me password s3cret\n", "gitlab.example.com", "s3cret"},
+		{"several lines", "machine gitlab.example.com\n  login me\n  password s3cret\n", "gitlab.example.com", "s3cret"},
+		{"other host", "machine github.com login me password gh\nmachine gitlab.example.com login me password gl\n", "gitlab.example.com", "gl"},
+		{"no entry", "machine github.com login me password gh\n", "gitlab.example.com", ""},
+		{"default", "machine github.com password gh\ndefault login me password fallback\n", "gitlab.example.com", "fallback"},
+		{"host before default", "default password fallback\nmachine gitlab.example.com password gl\n", "gitlab.example.com", "gl"},
+		{"first entry wins", "machine gitlab.example.com password one\nmachine gitlab.example.com password two\n", "gitlab.example.com", "one"},
+		{"comment", "# machine gitlab.example.com password old\nmachine gitlab.example.com password new # current\n", "gitlab.example.com", "new"},
+		{"macdef skipped", "macdef init\nmachine gitlab.example.com password inmacro\n\nmachine gitlab.example.com password real\n", "gitlab.example.com", "real"},
+		{"password before any entry", "password stray\nmachine gitlab.example.com login me\n", "gitlab.example.com", ""},
+		{"empty", "", "gitlab.example.com", ""},
+	}
+	for _, tt := range tests {
+		if got := netrcPassword(tt.data, tt.host); got != tt.want {
+			t.Errorf("%s: netrcPassword = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNetrcToken(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "netrc")
+	if err := ioutil.WriteFile(file, []byte("machine gitlab.example.com password s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NETRC", file)
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://gitlab.example.com/", "s3cret"},
+		{"https://gitlab.example.com:8443/", "s3cret"},
+		{"https://other.example.com/", ""},
+		{"not a url", ""},
+	}
+	for _, tt := range tests {
+		if got := netrcToken(tt.url); got != tt.want {
+			t.Errorf("netrcToken(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
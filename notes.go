@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/jgoodall/gitlab-list-tags/pkg/gitlabtags"
+)
+
+var (
+	notesTmplFile string
+
+	// notesTmpl is the parsed -notes-template, or nil if none was given.
+	notesTmpl *template.Template
+)
+
+// notesTemplateFlag registers the -notes-template flag on fs.
+func notesTemplateFlag(fs *flag.FlagSet) {
+	fs.StringVar(&notesTmplFile, "notes-template", "", "File containing a Go text/template for the notes of each version, used for the changelog and for the description of created releases")
+}
+
+// releaseNotes is the data -notes-template is executed with for each
+// version.
+type releaseNotes struct {
+	// Version is the version, or the tag name if it is not one, and Date
+	// the date of its commit as YYYY-MM-DD.
+	Version string
+	Date    string
+	Tag     gitlabtags.Tag
+
+	// Previous is the name of the previous version's tag, and CompareURL
+	// the URL of the page comparing it with Tag; both are empty for the
+	// first version.
+	Previous   string
+	CompareURL string
+
+	// Commits are the commits since the previous version, newest first, and
+	// MergeRequests the merge requests they merged.
+	Commits       []gitlabtags.Commit
+	MergeRequests []notesMergeRequest
+
+	// BreakingChanges are the breaking changes described in the tag and
+	// commit messages, and Contributors the authors of the commits.
+	BreakingChanges []string
+	Contributors    []string
+
+	// Notes are the notes generated by GitLab with -changelog-source gitlab.
+	Notes string
+}
+
+// notesMergeRequest is a merge request in releaseNotes.
+type notesMergeRequest struct {
+	// Ref is the reference to the merge request, such as "!12", or
+	// "group/project!12" in another project.
+	Ref   string
+	Title string
+	URL   string
+}
+
+// parseNotesTemplate parses -notes-template into notesTmpl, if it was given.
+func parseNotesTemplate() {
+	if notesTmplFile == "" || notesTmpl != nil {
+		return
+	}
+	b, err := ioutil.ReadFile(notesTmplFile)
+	if err != nil {
+		fatal("error reading notes template", "err", err)
+	}
+	funcs := template.FuncMap{"join": strings.Join, "linkIssues": linkIssueRefs}
+	for name, f := range templateFuncs {
+		funcs[name] = f
+	}
+	notesTmpl, err = template.New("notes").Funcs(funcs).Parse(string(b))
+	if err != nil {
+		fatal("error parsing notes template", "err", err)
+	}
+}
+
+// newReleaseNotes returns the releaseNotes of tag, whose previous version is
+// prev, or nil if it is the first, and whose commits since then are commits,
+// oldest first.
+func newReleaseNotes(tag gitlabtags.Tag, prev *gitlabtags.Tag, commits []gitlabtags.Commit) releaseNotes {
+	n := releaseNotes{
+		Version:         changelogVersion(tag),
+		Tag:             tag,
+		BreakingChanges: breakingChanges(tag, commits),
+		Contributors:    contributors(commits),
+		Notes:           tagNotes[tag.Name],
+	}
+	if !tag.Commit.CreatedAt.IsZero() {
+		n.Date = tag.Commit.CreatedAt.Format("2006-01-02")
+	}
+	if prev != nil {
+		n.Previous = prev.Name
+		n.CompareURL = compareURL(prev.Name, tag.Name)
+	}
+	for j := len(commits) - 1; j >= 0; j-- {
+		commit := commits[j]
+		n.Commits = append(n.Commits, commit)
+		if path, iid := mergeRequestRef(commit); path != "" {
+			ref := "!" + strconv.Itoa(iid)
+			if path != org+"/"+repo {
+				ref = path + ref
+			}
+			n.MergeRequests = append(n.MergeRequests, notesMergeRequest{Ref: ref, Title: commit.Title, URL: mergeRequestURL(path, iid)})
+		}
+	}
+	return n
+}
+
+// renderNotes executes notesTmpl with n.
+func renderNotes(n releaseNotes) string {
+	var b strings.Builder
+	if err := notesTmpl.Execute(&b, n); err != nil {
+		fatal("error executing notes template", "err", err)
+	}
+	return b.String()
+}
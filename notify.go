@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+
+	"github.com/jgoodall/gitlab-list-tags/pkg/gitlabtags"
+)
+
+var (
+	notifyTargets        string
+	slackWebhook         string
+	mattermostWebhook    string
+	teamsWebhook         string
+	webhookURL           string
+	webhookSigningSecret string
+	smtpHost             string
+	smtpUser             string
+	smtpPassword         string
+	mailFrom             string
+	mailTo               string
+)
+
+// notifyFlags registers the flags choosing where new tags are announced on
+// fs.
+func notifyFlags(fs *flag.FlagSet) {
+	fs.StringVar(&notifyTargets, "notify", "", "Comma separated places to announce new tags found by -only-new, -watch, or serve-webhook: slack, mattermost, teams, email, or webhook")
+	fs.StringVar(&slackWebhook, "slack-webhook", "", "URL of the Slack incoming webhook for -notify slack")
+	fs.StringVar(&mattermostWebhook, "mattermost-webhook", "", "URL of the Mattermost incoming webhook for -notify mattermost")
+	fs.StringVar(&teamsWebhook, "teams-webhook", "", "URL of the Microsoft Teams incoming webhook for -notify teams")
+	fs.StringVar(&webhookURL, "webhook-url", "", "URL to POST the new tags to, as JSON, for -notify webhook")
+	fs.StringVar(&webhookSigningSecret, "webhook-signing-secret", "", "Secret to sign the body posted by -notify webhook with, in the X-Signature-256 header")
+	fs.StringVar(&smtpHost, "smtp-host", "", "SMTP server, as host:port, to send -notify email through")
+	fs.StringVar(&smtpUser, "smtp-user", "", "User to authenticate to the SMTP server as, if it requires it")
+	fs.StringVar(&smtpPassword, "smtp-password", "", "Password of -smtp-user (or SMTP_PASSWORD)")
+	fs.StringVar(&mailFrom, "mail-from", "", "Sender address of -notify email")
+	fs.StringVar(&mailTo, "mail-to", "", "Comma separated recipient addresses of -notify email")
+}
+
+// notifier announces new tags in one place, such as a chat service.
+type notifier interface {
+	// check returns an error if the flags the notifier needs are missing.
+	check() error
+
+	// notify announces tags, the new tags of the current project.
+	notify(ctx context.Context, tags gitlabtags.Tags) error
+}
+
+// notifiers are the places -notify can name.
+var notifiers = map[string]notifier{
+	"slack":      slackNotifier{},
+	"mattermost": mattermostNotifier{},
+	"teams":      teamsNotifier{},
+	"email":      emailNotifier{},
+	"webhook":    webhookNotifier{},
+}
+
+// checkNotify exits if -notify names an unknown place or one whose settings
+// are missing.
+func checkNotify() {
+	if notifyTargets == "" {
+		return
+	}
+	for _, target := range strings.Split(notifyTargets, ",") {
+		n, ok := notifiers[target]
+		if !ok {
+			fatal("unknown -notify", "notify", target)
+		}
+		if err := n.check(); err != nil {
+			fatal("invalid notification settings", "notify", target, "err", err)
+		}
+	}
+}
+
+// recordNew announces tags, found by -only-new, with -notify, and records them
+// as seen.
+func recordNew(ctx context.Context, tags gitlabtags.Tags) {
+	if onlyNew && len(tags) > 0 {
+		if err := notifyNew(ctx, tags); err != nil {
+			exitIfInterrupted(ctx)
+			fatal("error sending notifications", "project", project(), "err", err)
+		}
+	}
+	saveSeen(tags)
+}
+
+// notifyNew announces the new tags of the current project at each of the
+// places given by -notify.
+func notifyNew(ctx context.Context, tags gitlabtags.Tags) error {
+	if notifyTargets == "" || len(tags) == 0 {
+		return nil
+	}
+	for _, target := range strings.Split(notifyTargets, ",") {
+		if err := notifiers[target].notify(ctx, tags); err != nil {
+			return fmt.Errorf("%s: %w", target, err)
+		}
+	}
+	return nil
+}
+
+// slackNotifier posts messages to a Slack incoming webhook.
+type slackNotifier struct{}
+
+func (slackNotifier) check() error {
+	if slackWebhook == "" {
+		return errors.New("-notify slack requires -slack-webhook")
+	}
+	return nil
+}
+
+// notify posts a message announcing tags to -slack-webhook, in Slack's own
+// markup.
+func (slackNotifier) notify(ctx context.Context, tags gitlabtags.Tags) error {
+	var b strings.Builder
+	for i, tag := range tags {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		name := slackEscape(org + "/" + repo + " " + tag.Name)
+		if u := tagURL(tag.Name); u != "" {
+			name = "<" + u + "|" + name + ">"
+		}
+		fmt.Fprintf(&b, "New release *%s*", name)
+		if msg := strings.TrimSpace(tag.Message); msg != "" {
+			b.WriteString("\n>" + strings.Replace(slackEscape(msg), "\n", "\n>", -1))
+		}
+	}
+	return postJSON(ctx, slackWebhook, map[string]string{"text": b.String()})
+}
+
+// mattermostNotifier posts messages to a Mattermost incoming webhook.
+type mattermostNotifier struct{}
+
+func (mattermostNotifier) check() error {
+	if mattermostWebhook == "" {
+		return errors.New("-notify mattermost requires -mattermost-webhook")
+	}
+	return nil
+}
+
+// notify posts a message announcing tags, in markdown, to
+// -mattermost-webhook.
+func (mattermostNotifier) notify(ctx context.Context, tags gitlabtags.Tags) error {
+	return postJSON(ctx, mattermostWebhook, map[string]string{"text": markdownAnnouncement(tags)})
+}
+
+// teamsNotifier posts message cards to a Microsoft Teams incoming webhook.
+type teamsNotifier struct{}
+
+func (teamsNotifier) check() error {
+	if teamsWebhook == "" {
+		return errors.New("-notify teams requires -teams-webhook")
+	}
+	return nil
+}
+
+// notify posts a message card announcing tags to -teams-webhook, with a
+// section and a button linking to it for each tag.
+func (teamsNotifier) notify(ctx context.Context, tags gitlabtags.Tags) error {
+	type target struct {
+		OS  string `json:"os"`
+		URI string `json:"uri"`
+	}
+	type action struct {
+		Type    string   `json:"@type"`
+		Name    string   `json:"name"`
+		Targets []target `json:"targets"`
+	}
+	type section struct {
+		ActivityTitle string   `json:"activityTitle"`
+		Text          string   `json:"text,omitempty"`
+		Actions       []action `json:"potentialAction,omitempty"`
+	}
+	card := struct {
+		Type     string    `json:"@type"`
+		Context  string    `json:"@context"`
+		Summary  string    `json:"summary"`
+		Title    string    `json:"title"`
+		Sections []section `json:"sections"`
+	}{
+		Type:    "MessageCard",
+		Context: "https://schema.org/extensions",
+		Summary: announcementSubject(tags),
+		Title:   announcementSubject(tags),
+	}
+	for _, tag := range tags {
+		sec := section{ActivityTitle: tag.Name, Text: strings.Replace(strings.TrimSpace(tag.Message), "\n", "\n\n", -1)}
+		if u := tagURL(tag.Name); u != "" {
+			sec.Actions = []action{{Type: "OpenUri", Name: "View " + tag.Name, Targets: []target{{OS: "default", URI: u}}}}
+		}
+		card.Sections = append(card.Sections, sec)
+	}
+	return postJSON(ctx, teamsWebhook, card)
+}
+
+// markdownAnnouncement returns a message announcing tags in markdown: a link
+// to each tag followed by its message, quoted.
+func markdownAnnouncement(tags gitlabtags.Tags) string {
+	var b strings.Builder
+	for i, tag := range tags {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		name := org + "/" + repo + " " + tag.Name
+		if u := tagURL(tag.Name); u != "" {
+			name = "[" + name + "](" + u + ")"
+		}
+		fmt.Fprintf(&b, "New release **%s**", name)
+		if msg := strings.TrimSpace(tag.Message); msg != "" {
+			b.WriteString("\n> " + strings.Replace(msg, "\n", "\n> ", -1))
+		}
+	}
+	return b.String()
+}
+
+// announcementSubject returns a one line summary announcing tags, such as
+// the subject of an email.
+func announcementSubject(tags gitlabtags.Tags) string {
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Name
+	}
+	if len(tags) > 1 {
+		return fmt.Sprintf("New releases of %s/%s: %s", org, repo, strings.Join(names, ", "))
+	}
+	return fmt.Sprintf("New release of %s/%s: %s", org, repo, strings.Join(names, ", "))
+}
+
+// webhookNotifier posts the new tags, as JSON, to any HTTP endpoint.
+type webhookNotifier struct{}
+
+func (webhookNotifier) check() error {
+	if webhookURL == "" {
+		return errors.New("-notify webhook requires -webhook-url")
+	}
+	return nil
+}
+
+// notify posts an object holding the project's path and tags, each as
+// written by printJSON, to -webhook-url. If -webhook-signing-secret is set,
+// the X-Signature-256 header holds "sha256=" and the hex HMAC-SHA256 of the
+// body, keyed with it, so that the receiver can check where it came from.
+func (webhookNotifier) notify(ctx context.Context, tags gitlabtags.Tags) error {
+	var buf bytes.Buffer
+	if err := printJSON(&buf, tags); err != nil {
+		return err
+	}
+	body, err := json.Marshal(struct {
+		Project string          `json:"project"`
+		Tags    json.RawMessage `json:"tags"`
+	}{org + "/" + repo, buf.Bytes()})
+	if err != nil {
+		return err
+	}
+	header := make(http.Header)
+	if webhookSigningSecret != "" {
+		mac := hmac.New(sha256.New, []byte(webhookSigningSecret))
+		mac.Write(body)
+		header.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	return post(ctx, webhookURL, body, header)
+}
+
+// emailNotifier sends email through an SMTP server.
+type emailNotifier struct{}
+
+func (emailNotifier) check() error {
+	if smtpHost == "" || mailFrom == "" || mailTo == "" {
+		return errors.New("-notify email requires -smtp-host, -mail-from, and -mail-to")
+	}
+	return nil
+}
+
+// notify sends the release notes of tags to -mail-to through -smtp-host,
+// using STARTTLS if the server supports it.
+func (emailNotifier) notify(ctx context.Context, tags gitlabtags.Tags) error {
+	subject := announcementSubject(tags)
+
+	var body strings.Builder
+	for i, tag := range tags {
+		if i > 0 {
+			body.WriteString("\n")
+		}
+		fmt.Fprintf(&body, "%s\n", tag.Name)
+		if u := tagURL(tag.Name); u != "" {
+			fmt.Fprintf(&body, "%s\n", u)
+		}
+		if entry := changelogEntry(tag); entry != "" {
+			fmt.Fprintf(&body, "\n%s", entry)
+		}
+	}
+
+	var to []string
+	for _, addr := range strings.Split(mailTo, ",") {
+		to = append(to, strings.TrimSpace(addr))
+	}
+	msg := "From: " + mailFrom + "\r\n" +
+		"To: " + strings.Join(to, ", ") + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + strings.Replace(body.String(), "\n", "\r\n", -1)
+
+	var auth smtp.Auth
+	if smtpUser != "" {
+		host, _, err := net.SplitHostPort(smtpHost)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", smtpUser, smtpPassword, host)
+	}
+	return smtp.SendMail(smtpHost, auth, mailFrom, to, []byte(msg))
+}
+
+// slackEscape escapes the characters Slack gives a meaning to in message
+// text.
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// postJSON posts v, encoded as JSON, to u.
+func postJSON(ctx context.Context, u string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return post(ctx, u, body, nil)
+}
+
+// post posts the JSON body to u, with the extra headers in header, and
+// returns an error unless the response has a 2xx status.
+func post(ctx context.Context, u string, body []byte, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := (&http.Client{Timeout: timeout}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
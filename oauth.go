@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// oauthToken is an OAuth token saved in the keyring by auth login.
+type oauthToken struct {
+	ClientID     string    `json:"client_id"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+// oauthResponse is a response from the GitLab OAuth endpoints.
+type oauthResponse struct {
+	// Device authorization response.
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	Interval                int    `json:"interval"`
+
+	// Token response.
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// oauthDeviceLogin runs the OAuth 2.0 device authorization grant against the
+// GitLab instance at base: it asks the user to visit the verification URL and
+// enter a code, then polls until they have done so.
+func oauthDeviceLogin(ctx context.Context, hc *http.Client, base, clientID, scope string) (*oauthToken, error) {
+	base = strings.TrimSuffix(base, "/")
+	var dev oauthResponse
+	if err := postOAuth(ctx, hc, base+"/oauth/authorize_device", url.Values{
+		"client_id": {clientID},
+		"scope":     {scope},
+	}, &dev); err != nil {
+		return nil, err
+	}
+
+	verify := dev.VerificationURIComplete
+	if verify == "" {
+		verify = dev.VerificationURI
+	}
+	fmt.Fprintf(os.Stderr, "To log in, open %s and enter the code %s\n", verify, dev.UserCode)
+
+	interval := time.Duration(dev.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+		var resp oauthResponse
+		err := postOAuth(ctx, hc, base+"/oauth/token", url.Values{
+			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+			"device_code": {dev.DeviceCode},
+			"client_id":   {clientID},
+		}, &resp)
+		switch resp.Error {
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval += 5 * time.Second
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return newOAuthToken(clientID, resp), nil
+	}
+}
+
+// loadOAuthToken decodes an OAuth token saved for account, refreshing and
+// re-saving it if the access token has expired.
+func loadOAuthToken(ctx context.Context, hc *http.Client, base, account, saved string) (*oauthToken, error) {
+	var t oauthToken
+	if err := json.Unmarshal([]byte(saved), &t); err != nil {
+		return nil, err
+	}
+	if t.Expiry.IsZero() || time.Now().Before(t.Expiry.Add(-time.Minute)) {
+		return &t, nil
+	}
+	if t.RefreshToken == "" {
+		return nil, errors.New("token has expired; run auth login again")
+	}
+
+	var resp oauthResponse
+	if err := postOAuth(ctx, hc, strings.TrimSuffix(base, "/")+"/oauth/token", url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {t.RefreshToken},
+		"client_id":     {t.ClientID},
+	}, &resp); err != nil {
+		return nil, fmt.Errorf("error refreshing token: %w", err)
+	}
+	refreshed := newOAuthToken(t.ClientID, resp)
+	if err := saveOAuthToken(account, refreshed); err != nil {
+		return nil, err
+	}
+	return refreshed, nil
+}
+
+// saveOAuthToken saves t in the keyring for account.
+func saveOAuthToken(account string, t *oauthToken) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return keyringSet(keyringService, account, string(b))
+}
+
+// newOAuthToken returns the token from a token response.
+func newOAuthToken(clientID string, resp oauthResponse) *oauthToken {
+	t := &oauthToken{
+		ClientID:     clientID,
+		AccessToken:  resp.AccessToken,
+		RefreshToken: resp.RefreshToken,
+	}
+	if resp.ExpiresIn > 0 {
+		t.Expiry = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	}
+	return t
+}
+
+// postOAuth posts form to the OAuth endpoint u and decodes the response into
+// resp, returning an error if the endpoint reports one.
+func postOAuth(ctx context.Context, hc *http.Client, u string, form url.Values, resp *oauthResponse) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", u, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("error creating request for url %s: %w", u, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r, err := hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting to url %s: %w", u, err)
+	}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(resp); err != nil {
+		return fmt.Errorf("error decoding json for url %s: %w (%s)", u, err, r.Status)
+	}
+	if resp.Error != "" {
+		return fmt.Errorf("%s: %s", resp.Error, resp.ErrorDescription)
+	}
+	if r.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response %s from url %s", r.Status, u)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var (
+	outputFile string
+
+	// out is where the list and changelog commands write their output:
+	// stdout, or outBuf with -output-file.
+	out    io.Writer = os.Stdout
+	outBuf *bytes.Buffer
+)
+
+// outputFileFlags registers the -output-file flag, and -o for short, on fs.
+func outputFileFlags(fs *flag.FlagSet) {
+	const usage = "Write the output to this file, replacing it only once all of it has been generated"
+	fs.StringVar(&outputFile, "output-file", "", usage)
+	fs.StringVar(&outputFile, "o", "", usage+" (shorthand for -output-file)")
+}
+
+// openOutput makes out collect the output in memory if -output-file is set,
+// so that nothing is written to the file unless the command succeeds.
+func openOutput() {
+	if outputFile != "" {
+		outBuf = new(bytes.Buffer)
+		out = outBuf
+	}
+}
+
+// closeOutput writes the collected output to -output-file, if it is set.
+func closeOutput() {
+	if outBuf == nil {
+		return
+	}
+	if err := writeFileAtomic(outputFile, outBuf.Bytes()); err != nil {
+		fatal("error writing output file", "output_file", outputFile, "err", err)
+	}
+}
+
+// writeFileAtomic replaces the file at path with data, writing it to a
+// temporary file in the same directory and renaming that over path, so that
+// the file is never left partly written. An existing file keeps its
+// permissions.
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
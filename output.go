@@ -0,0 +1,403 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jgoodall/gitlab-list-tags/pkg/gitlabtags"
+)
+
+// printers maps each -output format to the function that writes it.
+var printers = map[string]func(io.Writer, gitlabtags.Tags) error{
+	"text":  printText,
+	"json":  printJSON,
+	"jsonl": printJSONL,
+	"csv":   printDelimited(','),
+	"tsv":   printDelimited('\t'),
+
+	"changelog": printChangelog,
+	"html":      printHTML,
+	"atom":      printAtom,
+}
+
+// streamed are the output formats that write each tag independently of the
+// others, so that the tags can be written a page at a time as they are
+// retrieved, rather than all held until the end.
+var streamed = map[string]bool{
+	"text":      true,
+	"jsonl":     true,
+	"porcelain": true,
+}
+
+// printText writes each tag name, prefixed by namePrefix, followed by its
+// byline, web link, and message. Protected tags are marked as such, as are
+// signatures if they were fetched, and releases also have their title and
+// asset links written.
+func printText(w io.Writer, tags gitlabtags.Tags) error {
+	for _, tag := range tags {
+		title := ""
+		if tag.Protected {
+			title = " (protected)"
+		}
+		if !tag.Annotated() {
+			title += " (lightweight)"
+		}
+		if sig := tag.Signature; sig != nil {
+			title += " (" + signatureText(sig) + ")"
+		}
+		if len(tag.Aliases) > 0 {
+			title += " (also " + strings.Join(tag.Aliases, ", ") + ")"
+		}
+		if r := tag.Release; r != nil && r.Name != "" && r.Name != tag.Name {
+			title += " - " + r.Name
+		}
+		if _, err := fmt.Fprintf(w, "%s %s%s\n", namePrefix, tag.Name, title); err != nil {
+			return err
+		}
+		if by := byline(tag); by != "" {
+			if _, err := fmt.Fprintln(w, by); err != nil {
+				return err
+			}
+		}
+		if link := tagURL(tag.Name); link != "" {
+			if _, err := fmt.Fprintln(w, link); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintln(w, textMessage(tag.Message)); err != nil {
+			return err
+		}
+		if tag.Release != nil {
+			for _, l := range tag.Release.Assets.Links {
+				if _, err := fmt.Fprintf(w, "%s: %s\n", l.Name, l.URL); err != nil {
+					return err
+				}
+			}
+		}
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// byline describes who created tag and when, e.g. "Tagged by Jane Doe on
+// 2020-01-02, commit 1a2b3c4d by John Doe <john@example.com> on 2020-01-01".
+func byline(tag gitlabtags.Tag) string {
+	var parts []string
+	if tag.Tagger != "" || !tag.CreatedAt.IsZero() {
+		s := "Tagged"
+		if tag.Tagger != "" {
+			s += " by " + tag.Tagger
+		}
+		if !tag.CreatedAt.IsZero() {
+			s += " on " + tag.CreatedAt.Format("2006-01-02")
+		}
+		parts = append(parts, s)
+	}
+	c := tag.Commit
+	if c.ShortID != "" || c.AuthorName != "" || !c.CreatedAt.IsZero() {
+		s := "commit"
+		if c.ShortID != "" {
+			s += " " + c.ShortID
+		}
+		if c.AuthorName != "" {
+			s += " by " + c.AuthorName
+			if c.AuthorEmail != "" {
+				s += " <" + c.AuthorEmail + ">"
+			}
+		}
+		if !c.CreatedAt.IsZero() {
+			s += " on " + c.CreatedAt.Format("2006-01-02")
+		}
+		parts = append(parts, s)
+	}
+	s := strings.Join(parts, ", ")
+	if s != "" {
+		s = strings.ToUpper(s[:1]) + s[1:]
+	}
+	return s
+}
+
+// signatureText describes sig, e.g. "verified PGP signature".
+func signatureText(sig *gitlabtags.Signature) string {
+	if sig.Status == gitlabtags.SignatureUnsigned {
+		return "unsigned"
+	}
+	return strings.Replace(sig.Status, "_", " ", -1) + " " + sig.Type + " signature"
+}
+
+// jsonTag is the representation of a tag written by printJSON.
+type jsonTag struct {
+	Name    string    `json:"name"`
+	Message string    `json:"message"`
+	Version string    `json:"version,omitempty"`
+	Commit  string    `json:"commit"`
+	Date    time.Time `json:"date"`
+
+	Aliases     []string `json:"aliases,omitempty"`
+	ShortCommit string   `json:"short_commit,omitempty"`
+	URL         string   `json:"url,omitempty"`
+	CommitURL   string   `json:"commit_url,omitempty"`
+
+	Tagger     string     `json:"tagger,omitempty"`
+	TaggedDate *time.Time `json:"tagged_date,omitempty"`
+
+	Author         string     `json:"author,omitempty"`
+	AuthorEmail    string     `json:"author_email,omitempty"`
+	AuthoredDate   *time.Time `json:"authored_date,omitempty"`
+	Committer      string     `json:"committer,omitempty"`
+	CommitterEmail string     `json:"committer_email,omitempty"`
+	CommittedDate  *time.Time `json:"committed_date,omitempty"`
+
+	Annotated bool           `json:"annotated"`
+	Protected bool           `json:"protected"`
+	Signature *jsonSignature `json:"signature,omitempty"`
+	Release   *jsonRelease   `json:"release,omitempty"`
+}
+
+// jsonSignature is the representation of a signature written by printJSON.
+type jsonSignature struct {
+	Type   string `json:"type,omitempty"`
+	Status string `json:"status"`
+}
+
+// jsonRelease is the representation of a release written by printJSON.
+type jsonRelease struct {
+	Title       string      `json:"title"`
+	Description string      `json:"description"`
+	Assets      []jsonAsset `json:"assets"`
+}
+
+// jsonAsset is the representation of a release asset written by printJSON.
+type jsonAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// printJSON writes the tags as a single JSON array. Version is omitted for
+// tags whose name could not be parsed as a semantic version, signature unless
+// signatures were fetched, and release for tags without a release.
+func printJSON(w io.Writer, tags gitlabtags.Tags) error {
+	out := make([]jsonTag, len(tags))
+	for i, tag := range tags {
+		out[i] = newJSONTag(tag)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// jsonlTag is the representation of a tag written by printJSONL: that of
+// printJSON, with the path of its project.
+type jsonlTag struct {
+	Project string `json:"project"`
+	jsonTag
+}
+
+// printJSONL writes each tag as a JSON object on a line of its own, as JSON
+// Lines, so that the output can be written as the tags are retrieved and
+// read a line at a time.
+func printJSONL(w io.Writer, tags gitlabtags.Tags) error {
+	enc := json.NewEncoder(w)
+	for _, tag := range tags {
+		if err := enc.Encode(jsonlTag{org + "/" + repo, newJSONTag(tag)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newJSONTag returns the representation of tag in the JSON output.
+func newJSONTag(tag gitlabtags.Tag) jsonTag {
+	t := jsonTag{
+		Name:    tag.Name,
+		Message: tag.Message,
+		Commit:  tag.Commit.ID,
+		Date:    tag.Commit.CreatedAt,
+	}
+	t.Aliases = tag.Aliases
+	t.ShortCommit = tag.Commit.ShortID
+	t.URL = tagURL(tag.Name)
+	t.CommitURL = tag.Commit.WebURL
+	t.Tagger = tag.Tagger
+	t.TaggedDate = optionalTime(tag.CreatedAt)
+	t.Author = tag.Commit.AuthorName
+	t.AuthorEmail = tag.Commit.AuthorEmail
+	t.AuthoredDate = optionalTime(tag.Commit.AuthoredDate)
+	t.Committer = tag.Commit.CommitterName
+	t.CommitterEmail = tag.Commit.CommitterEmail
+	t.CommittedDate = optionalTime(tag.Commit.CommittedDate)
+	t.Annotated = tag.Annotated()
+	t.Protected = tag.Protected
+	if sig := tag.Signature; sig != nil {
+		t.Signature = &jsonSignature{sig.Type, sig.Status}
+	}
+	if tag.Parsed {
+		t.Version = tag.Version.String()
+	}
+	if r := tag.Release; r != nil {
+		t.Release = &jsonRelease{Title: r.Name, Description: r.Description, Assets: []jsonAsset{}}
+		for _, l := range r.Assets.Links {
+			t.Release.Assets = append(t.Release.Assets, jsonAsset{l.Name, l.URL})
+		}
+	}
+	return t
+}
+
+// optionalTime returns a pointer to t, or nil if t is zero, so that unknown
+// times are omitted from the JSON output.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// csvTime formats t for the CSV output, or returns an empty string if t is
+// zero.
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// csvColumns maps each column name accepted by -columns to the function that
+// extracts its value from a tag.
+var csvColumns = map[string]func(gitlabtags.Tag) string{
+	"name": func(t gitlabtags.Tag) string { return t.Name },
+	"version": func(t gitlabtags.Tag) string {
+		if !t.Parsed {
+			return ""
+		}
+		return t.Version.String()
+	},
+	"date":            func(t gitlabtags.Tag) string { return csvTime(t.Commit.CreatedAt) },
+	"aliases":         func(t gitlabtags.Tag) string { return strings.Join(t.Aliases, " ") },
+	"annotated":       func(t gitlabtags.Tag) string { return strconv.FormatBool(t.Annotated()) },
+	"commit":          func(t gitlabtags.Tag) string { return t.Commit.ID },
+	"short_commit":    func(t gitlabtags.Tag) string { return t.Commit.ShortID },
+	"url":             func(t gitlabtags.Tag) string { return tagURL(t.Name) },
+	"commit_url":      func(t gitlabtags.Tag) string { return t.Commit.WebURL },
+	"tagger":          func(t gitlabtags.Tag) string { return t.Tagger },
+	"tagged_date":     func(t gitlabtags.Tag) string { return csvTime(t.CreatedAt) },
+	"author":          func(t gitlabtags.Tag) string { return t.Commit.AuthorName },
+	"author_email":    func(t gitlabtags.Tag) string { return t.Commit.AuthorEmail },
+	"authored_date":   func(t gitlabtags.Tag) string { return csvTime(t.Commit.AuthoredDate) },
+	"committer":       func(t gitlabtags.Tag) string { return t.Commit.CommitterName },
+	"committer_email": func(t gitlabtags.Tag) string { return t.Commit.CommitterEmail },
+	"committed_date":  func(t gitlabtags.Tag) string { return csvTime(t.Commit.CommittedDate) },
+	"message":         func(t gitlabtags.Tag) string { return gitlabtags.FirstLine(t.Message) },
+	"protected":       func(t gitlabtags.Tag) string { return strconv.FormatBool(t.Protected) },
+	"signature": func(t gitlabtags.Tag) string {
+		if t.Signature == nil {
+			return ""
+		}
+		return t.Signature.Status
+	},
+	"title": func(t gitlabtags.Tag) string {
+		if t.Release == nil {
+			return ""
+		}
+		return t.Release.Name
+	},
+	"assets": func(t gitlabtags.Tag) string {
+		if t.Release == nil {
+			return ""
+		}
+		var urls []string
+		for _, l := range t.Release.Assets.Links {
+			urls = append(urls, l.URL)
+		}
+		return strings.Join(urls, " ")
+	},
+}
+
+// printPorcelain writes a line for each tag of tab separated fields: the
+// project's path, the tag name, its version, or nothing if it is not a
+// semantic version, its commit SHA, and the commit date in RFC 3339 format,
+// in UTC. Scripts rely on this format, so it must not change.
+func printPorcelain(w io.Writer, tags gitlabtags.Tags) error {
+	for _, tag := range tags {
+		var vers, date string
+		if tag.Parsed {
+			vers = tag.Version.String()
+		}
+		if !tag.Commit.CreatedAt.IsZero() {
+			date = tag.Commit.CreatedAt.UTC().Format(time.RFC3339)
+		}
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", org+"/"+repo, tag.Name, vers, tag.Commit.ID, date); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printDelimited returns a printer that writes a header row of the selected
+// columns followed by one row per tag, separated by comma.
+func printDelimited(comma rune) func(io.Writer, gitlabtags.Tags) error {
+	return func(w io.Writer, tags gitlabtags.Tags) error {
+		cols := strings.Split(columns, ",")
+		cw := csv.NewWriter(w)
+		cw.Comma = comma
+		if err := cw.Write(cols); err != nil {
+			return err
+		}
+		for _, tag := range tags {
+			row := make([]string, len(cols))
+			for i, c := range cols {
+				row[i] = csvColumns[c](tag)
+			}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+}
+
+// templateFuncs are the extra functions available to -template and
+// -template-file templates.
+var templateFuncs = template.FuncMap{
+	"firstLine": gitlabtags.FirstLine,
+	"trim":      strings.TrimSpace,
+	"tagURL":    tagURL,
+}
+
+// parseTemplate parses the template given inline as text or, if text is
+// empty, read from file.
+func parseTemplate(text, file string) (*template.Template, error) {
+	if text != "" && file != "" {
+		return nil, errors.New("only one of -template and -template-file may be given")
+	}
+	if file != "" {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		text = string(b)
+	}
+	return template.New("tag").Funcs(templateFuncs).Parse(text)
+}
+
+// printTemplate returns a printer that executes tmpl once for each tag.
+func printTemplate(tmpl *template.Template) func(io.Writer, gitlabtags.Tags) error {
+	return func(w io.Writer, tags gitlabtags.Tags) error {
+		for _, tag := range tags {
+			if err := tmpl.Execute(w, tag); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/jgoodall/gitlab-list-tags/pkg/gitlabtags"
+)
+
+// picker is the state of the pick command's list of tags.
+type picker struct {
+	tags    gitlabtags.Tags
+	query   []rune
+	matches []int // indexes of the tags matching query, best first
+	sel     int   // index in matches of the selected tag
+	top     int   // index in matches of the first tag shown
+}
+
+// runPick lets the user choose one of the selected tags, typing part of its
+// name to narrow the list, and prints its name. The list is drawn on the
+// terminal rather than stdout, so that the command can be used as in
+// "git checkout $(gitlab-list-tags pick)".
+func runPick(ctx context.Context, fs *flag.FlagSet) {
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	in, out, err := openTerminal()
+	if err != nil {
+		fatal("pick needs a terminal", "err", err)
+	}
+	defer in.Close()
+	defer out.Close()
+
+	tags, _ := listTags(ctx, newClient(ctx))
+	if len(tags) == 0 {
+		slog.Warn("no tags found", "project", project())
+		exit(errNoTags)
+	}
+
+	restore, err := rawTerminal(in, out)
+	if err != nil {
+		fatal("error setting up the terminal", "err", err)
+	}
+	fmt.Fprint(out, "\x1b[?1049h")
+	p := &picker{tags: tags, query: []rune(fs.Arg(0))}
+	p.filter()
+	name, ok := p.run(ctx, in, out)
+	fmt.Fprint(out, "\x1b[?1049l")
+	restore()
+	if !ok {
+		exit(&failure{exitInterrupted, "interrupted"})
+	}
+	fmt.Println(name)
+}
+
+// run reads keys from in, redrawing the list on out after each, until a tag
+// is chosen with Enter, whose name it returns, or picking is canceled.
+func (p *picker) run(ctx context.Context, in, out *os.File) (string, bool) {
+	keys := make(chan string)
+	go readKeys(in, keys)
+	for {
+		p.render(in, out)
+		var k string
+		select {
+		case <-ctx.Done():
+			return "", false
+		case key, ok := <-keys:
+			if !ok {
+				return "", false
+			}
+			k = key
+		}
+		switch k {
+		case "\x03", "\x1b":
+			return "", false
+		case "\r", "\n":
+			if len(p.matches) > 0 {
+				return p.tags[p.matches[p.sel]].Name, true
+			}
+		case "\x1b[A", "\x1bOA", "\x10":
+			if p.sel > 0 {
+				p.sel--
+			}
+		case "\x1b[B", "\x1bOB", "\x0e":
+			if p.sel < len(p.matches)-1 {
+				p.sel++
+			}
+		case "\x7f", "\x08":
+			if len(p.query) > 0 {
+				p.query = p.query[:len(p.query)-1]
+				p.filter()
+			}
+		case "\x15":
+			p.query = nil
+			p.filter()
+		default:
+			if typed := []rune(k); printableRunes(typed) {
+				p.query = append(p.query, typed...)
+				p.filter()
+			}
+		}
+	}
+}
+
+// printableRunes reports whether rs is typed text, rather than a key such as
+// an arrow or function key.
+func printableRunes(rs []rune) bool {
+	for _, r := range rs {
+		if unicode.IsControl(r) {
+			return false
+		}
+	}
+	return len(rs) > 0
+}
+
+// filter sets matches to the tags whose names fuzzily match the query, best
+// first, and selects the first.
+func (p *picker) filter() {
+	type match struct{ i, score int }
+	var ms []match
+	q := strings.ToLower(string(p.query))
+	for i, tag := range p.tags {
+		if score, ok := fuzzyMatch(strings.ToLower(tag.Name), q); ok {
+			ms = append(ms, match{i, score})
+		}
+	}
+	sort.SliceStable(ms, func(i, j int) bool { return ms[i].score < ms[j].score })
+	p.matches = p.matches[:0]
+	for _, m := range ms {
+		p.matches = append(p.matches, m.i)
+	}
+	p.sel, p.top = 0, 0
+}
+
+// fuzzyMatch reports whether the characters of query appear in name in
+// order, and if so scores the match by the number of characters it spans, so
+// lower is better and a name containing query itself scores best.
+func fuzzyMatch(name, query string) (int, bool) {
+	if query == "" {
+		return 0, true
+	}
+	q := []rune(query)
+	start, j := -1, 0
+	for i, r := range []rune(name) {
+		if r != q[j] {
+			continue
+		}
+		if j == 0 {
+			start = i
+		}
+		if j++; j == len(q) {
+			return i - start + 1, true
+		}
+	}
+	return 0, false
+}
+
+// render draws the query and the matching tags on out.
+func (p *picker) render(in, out *os.File) {
+	rows, cols := 24, 80
+	if r, c, err := terminalSize(in, out); err == nil && r > 2 && c > 10 {
+		rows, cols = r, c
+	}
+	height := rows - 2
+	if p.sel < p.top {
+		p.top = p.sel
+	}
+	if p.sel >= p.top+height {
+		p.top = p.sel - height + 1
+	}
+
+	w := bufio.NewWriter(out)
+	fmt.Fprint(w, "\x1b[H\x1b[2J")
+	fmt.Fprintf(w, "\x1b[2;1H\x1b[2m%s\x1b[0m", pad(fmt.Sprintf("  %d/%d", len(p.matches), len(p.tags)), cols))
+	for i := 0; i < height && p.top+i < len(p.matches); i++ {
+		name := pad("  "+p.tags[p.matches[p.top+i]].Name, cols)
+		if p.top+i == p.sel {
+			name = "\x1b[7m" + pad("> "+p.tags[p.matches[p.top+i]].Name, cols) + "\x1b[0m"
+		}
+		fmt.Fprintf(w, "\x1b[%d;1H%s", i+3, name)
+	}
+	// Leave the cursor after the query, where typing goes.
+	fmt.Fprintf(w, "\x1b[1;1H%s", pad("> "+string(p.query), cols-1))
+	fmt.Fprintf(w, "\x1b[1;%dH", len(p.query)+3)
+	w.Flush()
+}
@@ -0,0 +1,413 @@
+package gitlabtags
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BitbucketCloudURL is the API URL of Bitbucket Cloud.
+const BitbucketCloudURL = "https://api.bitbucket.org/"
+
+// bitbucketCloudWebURL is the root of the Bitbucket Cloud web UI.
+const bitbucketCloudWebURL = "https://bitbucket.org/"
+
+func init() {
+	Register("bitbucket-cloud", func(cfg Config) (Provider, error) {
+		return NewBitbucketCloudClient(cfg.BaseURL, cfg.Token, cfg.HTTPClient), nil
+	})
+	Register("bitbucket-server", func(cfg Config) (Provider, error) {
+		if cfg.BaseURL == "" {
+			return nil, errors.New("the Bitbucket Server url is required")
+		}
+		return NewBitbucketServerClient(cfg.BaseURL, cfg.Token, cfg.HTTPClient), nil
+	})
+}
+
+// BitbucketCloudClient retrieves tags from Bitbucket Cloud.
+type BitbucketCloudClient struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// NewBitbucketCloudClient returns a client for the Bitbucket Cloud API at
+// baseURL, or BitbucketCloudURL if baseURL is empty, authenticating with the
+// access token if it is not empty. If httpClient is nil, http.DefaultClient is
+// used.
+func NewBitbucketCloudClient(baseURL, token string, httpClient *http.Client) *BitbucketCloudClient {
+	if baseURL == "" {
+		baseURL = BitbucketCloudURL
+	}
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &BitbucketCloudClient{baseURL: baseURL, token: token, httpClient: httpClient}
+}
+
+// bitbucketCloudPage is a page of the Bitbucket Cloud refs/tags endpoint.
+type bitbucketCloudPage struct {
+	Values []struct {
+		Name    string    `json:"name"`
+		Message string    `json:"message"`
+		Date    time.Time `json:"date"`
+		Tagger  *struct {
+			Raw string `json:"raw"`
+		} `json:"tagger"`
+		Target struct {
+			Hash   string    `json:"hash"`
+			Date   time.Time `json:"date"`
+			Author struct {
+				Raw  string `json:"raw"`
+				User *struct {
+					DisplayName string `json:"display_name"`
+				} `json:"user"`
+			} `json:"author"`
+		} `json:"target"`
+	} `json:"values"`
+	Next string `json:"next"`
+}
+
+// ListTags returns the tags of the repository given as "workspace/repo_slug".
+// Options are applied as by Client.ListTags.
+func (c *BitbucketCloudClient) ListTags(ctx context.Context, project string, opts ListOptions) (tags Tags, errs []error, err error) {
+	ctx, end := startSpan(ctx, "ListTags", "project", project)
+	defer func() { end(err) }()
+	if opts.Releases || opts.Signatures || opts.OrderBy != "" {
+		return nil, nil, ErrNotSupported
+	}
+	workspace, slug, err := splitProject(project)
+	if err != nil {
+		return nil, nil, err
+	}
+	next := c.baseURL + "2.0/repositories/" + url.PathEscape(workspace) + "/" + url.PathEscape(slug) + "/refs/tags?pagelen=100"
+	for next != "" {
+		var page bitbucketCloudPage
+		if err := getBitbucketJSON(ctx, c.httpClient, next, c.token, &page); err != nil {
+			return nil, nil, err
+		}
+		for _, v := range page.Values {
+			t := Tag{
+				Name:      v.Name,
+				Message:   v.Message,
+				CreatedAt: v.Date,
+				Commit: Commit{
+					ID:           v.Target.Hash,
+					ShortID:      shortID(v.Target.Hash),
+					AuthorName:   authorName(v.Target.Author.Raw),
+					AuthorEmail:  authorEmail(v.Target.Author.Raw),
+					AuthoredDate: v.Target.Date,
+					CreatedAt:    v.Target.Date,
+				},
+			}
+			if v.Target.Author.User != nil {
+				t.Commit.AuthorName = v.Target.Author.User.DisplayName
+			}
+			if v.Tagger != nil {
+				t.Tagger = authorName(v.Tagger.Raw)
+			}
+			tags = append(tags, t)
+		}
+		if max := opts.fetchLimit(); max > 0 && len(tags) >= max {
+			tags = tags[:max]
+			break
+		}
+		next = page.Next
+	}
+	tags, errs = SelectTags(tags, opts)
+	return tags, errs, nil
+}
+
+// ListReleases returns ErrNotSupported; Bitbucket has no releases.
+func (c *BitbucketCloudClient) ListReleases(ctx context.Context, project string) ([]Release, error) {
+	return nil, ErrNotSupported
+}
+
+// bitbucketCloudCommits is a page of the Bitbucket Cloud commits endpoint.
+type bitbucketCloudCommits struct {
+	Values []struct {
+		Hash    string    `json:"hash"`
+		Message string    `json:"message"`
+		Date    time.Time `json:"date"`
+		Author  struct {
+			Raw string `json:"raw"`
+		} `json:"author"`
+	} `json:"values"`
+	Next string `json:"next"`
+}
+
+// CompareRefs returns the commits reachable from to but not from from.
+func (c *BitbucketCloudClient) CompareRefs(ctx context.Context, project, from, to string) (*Comparison, error) {
+	workspace, slug, err := splitProject(project)
+	if err != nil {
+		return nil, err
+	}
+	var commits []Commit
+	next := c.baseURL + "2.0/repositories/" + url.PathEscape(workspace) + "/" + url.PathEscape(slug) + "/commits/" + url.PathEscape(to) + "?" + url.Values{"exclude": {from}, "pagelen": {"100"}}.Encode()
+	for next != "" {
+		var page bitbucketCloudCommits
+		if err := getBitbucketJSON(ctx, c.httpClient, next, c.token, &page); err != nil {
+			return nil, err
+		}
+		for _, v := range page.Values {
+			commits = append(commits, Commit{
+				ID:           v.Hash,
+				ShortID:      shortID(v.Hash),
+				Title:        FirstLine(v.Message),
+				Message:      v.Message,
+				AuthorName:   authorName(v.Author.Raw),
+				AuthorEmail:  authorEmail(v.Author.Raw),
+				AuthoredDate: v.Date,
+				CreatedAt:    v.Date,
+			})
+		}
+		next = page.Next
+	}
+	reverseCommits(commits)
+	return &Comparison{Commits: commits}, nil
+}
+
+// TagsURL returns the URL of the page listing project's tags.
+func (c *BitbucketCloudClient) TagsURL(project string) string {
+	return bitbucketCloudWebURL + project + "/downloads/?tab=tags"
+}
+
+// TagURL returns the URL of the page for tag.
+func (c *BitbucketCloudClient) TagURL(project, tag string) string {
+	return bitbucketCloudWebURL + project + "/src/" + url.PathEscape(tag)
+}
+
+// CompareURL returns the URL of the page comparing from with to.
+func (c *BitbucketCloudClient) CompareURL(project, from, to string) string {
+	return bitbucketCloudWebURL + project + "/branches/compare/" + url.PathEscape(to) + "%0D" + url.PathEscape(from)
+}
+
+// BitbucketServerClient retrieves tags from Bitbucket Server or Data Center.
+type BitbucketServerClient struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// NewBitbucketServerClient returns a client for the Bitbucket Server instance
+// at baseURL (e.g. https://bitbucket.example.com/), authenticating with the
+// HTTP access token if it is not empty. If httpClient is nil,
+// http.DefaultClient is used.
+func NewBitbucketServerClient(baseURL, token string, httpClient *http.Client) *BitbucketServerClient {
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &BitbucketServerClient{baseURL: baseURL, token: token, httpClient: httpClient}
+}
+
+// bitbucketServerPage is a page of the Bitbucket Server tags endpoint.
+type bitbucketServerPage struct {
+	Values []struct {
+		DisplayID    string `json:"displayId"`
+		LatestCommit string `json:"latestCommit"`
+		Hash         string `json:"hash"`
+	} `json:"values"`
+	IsLastPage    bool `json:"isLastPage"`
+	NextPageStart int  `json:"nextPageStart"`
+}
+
+// ListTags returns the tags of the repository given as "PROJECT/repo_slug".
+// Bitbucket Server does not return tag messages or dates, so those are left
+// empty. Options are applied as by Client.ListTags.
+func (c *BitbucketServerClient) ListTags(ctx context.Context, project string, opts ListOptions) (tags Tags, errs []error, err error) {
+	ctx, end := startSpan(ctx, "ListTags", "project", project)
+	defer func() { end(err) }()
+	if opts.Releases || opts.Signatures || opts.OrderBy != "" {
+		return nil, nil, ErrNotSupported
+	}
+	key, slug, err := splitProject(project)
+	if err != nil {
+		return nil, nil, err
+	}
+	base := c.baseURL + "rest/api/1.0/projects/" + url.PathEscape(key) + "/repos/" + url.PathEscape(slug) + "/tags?limit=100&start="
+	start := 0
+	for {
+		var page bitbucketServerPage
+		if err := getBitbucketJSON(ctx, c.httpClient, base+strconv.Itoa(start), c.token, &page); err != nil {
+			return nil, nil, err
+		}
+		for _, v := range page.Values {
+			tags = append(tags, Tag{
+				Name:   v.DisplayID,
+				Commit: Commit{ID: v.LatestCommit, ShortID: shortID(v.LatestCommit)},
+				Target: v.Hash,
+			})
+		}
+		if max := opts.fetchLimit(); max > 0 && len(tags) >= max {
+			tags = tags[:max]
+			break
+		}
+		if page.IsLastPage || len(page.Values) == 0 {
+			break
+		}
+		start = page.NextPageStart
+	}
+	tags, errs = SelectTags(tags, opts)
+	return tags, errs, nil
+}
+
+// ListReleases returns ErrNotSupported; Bitbucket has no releases.
+func (c *BitbucketServerClient) ListReleases(ctx context.Context, project string) ([]Release, error) {
+	return nil, ErrNotSupported
+}
+
+// bitbucketServerCommits is a page of the Bitbucket Server compare endpoint.
+type bitbucketServerCommits struct {
+	Values []struct {
+		ID        string `json:"id"`
+		DisplayID string `json:"displayId"`
+		Message   string `json:"message"`
+		Author    struct {
+			Name string `json:"name"`
+		} `json:"author"`
+		AuthorTimestamp int64 `json:"authorTimestamp"`
+	} `json:"values"`
+	IsLastPage    bool `json:"isLastPage"`
+	NextPageStart int  `json:"nextPageStart"`
+}
+
+// CompareRefs returns the commits reachable from to but not from from.
+func (c *BitbucketServerClient) CompareRefs(ctx context.Context, project, from, to string) (*Comparison, error) {
+	key, slug, err := splitProject(project)
+	if err != nil {
+		return nil, err
+	}
+	// Bitbucket Server compares the "from" ref against the "to" ref, the
+	// reverse of the usual order.
+	base := c.baseURL + "rest/api/1.0/projects/" + url.PathEscape(key) + "/repos/" + url.PathEscape(slug) + "/compare/commits?" + url.Values{"from": {to}, "to": {from}, "limit": {"100"}}.Encode() + "&start="
+	var commits []Commit
+	start := 0
+	for {
+		var page bitbucketServerCommits
+		if err := getBitbucketJSON(ctx, c.httpClient, base+strconv.Itoa(start), c.token, &page); err != nil {
+			return nil, err
+		}
+		for _, v := range page.Values {
+			commits = append(commits, Commit{
+				ID:         v.ID,
+				ShortID:    v.DisplayID,
+				Title:      FirstLine(v.Message),
+				Message:    v.Message,
+				AuthorName: v.Author.Name,
+				CreatedAt:  time.Unix(0, v.AuthorTimestamp*int64(time.Millisecond)),
+			})
+		}
+		if page.IsLastPage || len(page.Values) == 0 {
+			break
+		}
+		start = page.NextPageStart
+	}
+	reverseCommits(commits)
+	return &Comparison{Commits: commits}, nil
+}
+
+// TagsURL returns the URL of the page listing project's tags.
+func (c *BitbucketServerClient) TagsURL(project string) string {
+	return c.repoURL(project) + "/tags"
+}
+
+// TagURL returns the URL of the page for tag.
+func (c *BitbucketServerClient) TagURL(project, tag string) string {
+	return c.repoURL(project) + "/browse?at=" + url.QueryEscape("refs/tags/"+tag)
+}
+
+// CompareURL returns the URL of the page comparing from with to.
+func (c *BitbucketServerClient) CompareURL(project, from, to string) string {
+	return c.repoURL(project) + "/compare/commits?" + url.Values{
+		"sourceBranch": {"refs/tags/" + to},
+		"targetBranch": {"refs/tags/" + from},
+	}.Encode()
+}
+
+// repoURL returns the URL of the repository's page in the web UI.
+func (c *BitbucketServerClient) repoURL(project string) string {
+	key, slug, _ := splitProject(project)
+	return c.baseURL + "projects/" + key + "/repos/" + slug
+}
+
+// getBitbucketJSON decodes the JSON response from u into v, authenticating
+// with token as a bearer token if it is not empty.
+func getBitbucketJSON(ctx context.Context, hc *http.Client, u, token string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request for url %s: %w", u, err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("error getting url %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp)
+	}
+	body, err := jsonBody(resp, "[{")
+	if err != nil {
+		return err
+	}
+	if err := json.NewDecoder(body).Decode(v); err != nil {
+		return fmt.Errorf("error decoding json for url %s: %w", u, err)
+	}
+	return nil
+}
+
+// splitProject splits a "owner/repo" project path at its last slash.
+func splitProject(project string) (owner, repo string, err error) {
+	i := strings.LastIndex(project, "/")
+	if i <= 0 || i == len(project)-1 {
+		return "", "", fmt.Errorf("project %s is not of the form owner/repo", project)
+	}
+	return project[:i], project[i+1:], nil
+}
+
+// shortID abbreviates a commit SHA the way GitLab's short_id does.
+func shortID(sha string) string {
+	if len(sha) > 8 {
+		return sha[:8]
+	}
+	return sha
+}
+
+// authorName returns the name from a "Name <email>" author string.
+func authorName(raw string) string {
+	if i := strings.Index(raw, " <"); i >= 0 {
+		return raw[:i]
+	}
+	return raw
+}
+
+// authorEmail returns the email address from a raw "Name <email>" author.
+func authorEmail(raw string) string {
+	i, j := strings.Index(raw, "<"), strings.LastIndex(raw, ">")
+	if i < 0 || j < i {
+		return ""
+	}
+	return raw[i+1 : j]
+}
+
+// reverseCommits reverses commits in place, so that commits returned newest
+// first by the API are ordered oldest first.
+func reverseCommits(commits []Commit) {
+	for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+		commits[i], commits[j] = commits[j], commits[i]
+	}
+}
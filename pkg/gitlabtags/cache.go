@@ -0,0 +1,186 @@
+package gitlabtags
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CacheTransport is an http.RoundTripper that caches successful GET responses
+// in Dir, keyed by URL, so repeated runs need not fetch the same tags again.
+type CacheTransport struct {
+	// Base makes the requests; http.DefaultTransport is used if it is nil.
+	Base http.RoundTripper
+
+	// Dir is the directory the responses are cached in.
+	Dir string
+
+	// TTL is how long a cached response is used without contacting the
+	// server. Zero means it is never used unrevalidated.
+	TTL time.Duration
+
+	// Revalidate makes stale responses carrying an ETag be revalidated with
+	// If-None-Match, so that an unchanged response costs the server a 304 Not
+	// Modified instead of a full listing.
+	Revalidate bool
+}
+
+// cacheEntry is a cached response, and the URL it was requested from.
+type cacheEntry struct {
+	Time   time.Time   `json:"time"`
+	URL    string      `json:"url,omitempty"`
+	ETag   string      `json:"etag,omitempty"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// response returns the cached response to req.
+func (e *cacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *CacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if req.Method != "GET" || req.Header.Get("If-None-Match") != "" {
+		return base.RoundTrip(req)
+	}
+
+	file := filepath.Join(t.Dir, cacheKey(req)+".json")
+	var cached *cacheEntry
+	if b, err := ioutil.ReadFile(file); err == nil {
+		var e cacheEntry
+		if json.Unmarshal(b, &e) == nil {
+			if t.TTL > 0 && time.Since(e.Time) < t.TTL {
+				return e.response(req), nil
+			}
+			if t.Revalidate && e.ETag != "" {
+				cached = &e
+				req = req.Clone(req.Context())
+				req.Header.Set("If-None-Match", e.ETag)
+			}
+		}
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		cached.Time = time.Now()
+		if b, err := json.Marshal(cached); err == nil {
+			writeCacheFile(file, b)
+		}
+		return cached.response(req), nil
+	}
+
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || (etag == "" || !t.Revalidate) && t.TTL <= 0 {
+		return resp, nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if b, err := json.Marshal(cacheEntry{Time: time.Now(), URL: req.URL.String(), ETag: etag, Header: resp.Header, Body: body}); err == nil {
+		writeCacheFile(file, b)
+	}
+	return resp, nil
+}
+
+// CachedProjects returns the paths of the GitLab projects, such as
+// "group/project", whose responses are cached in dir, sorted. Projects given
+// by numeric ID are left out.
+func CachedProjects(dir string) []string {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	seen := map[string]bool{}
+	var projects []string
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var e cacheEntry
+		if json.Unmarshal(b, &e) != nil || e.URL == "" {
+			continue
+		}
+		u, err := url.Parse(e.URL)
+		if err != nil {
+			continue
+		}
+		parts := strings.Split(u.EscapedPath(), "/")
+		for i := 0; i+1 < len(parts); i++ {
+			if parts[i] != "projects" {
+				continue
+			}
+			p, err := url.PathUnescape(parts[i+1])
+			if err == nil && strings.Contains(p, "/") && !seen[p] {
+				seen[p] = true
+				projects = append(projects, p)
+			}
+			break
+		}
+	}
+	sort.Strings(projects)
+	return projects
+}
+
+// cacheKey identifies the response to req: a hash of its URL and the
+// credentials it was made with, so that different tokens never share cached
+// responses.
+func cacheKey(req *http.Request) string {
+	h := sha256.New()
+	h.Write([]byte(req.URL.String()))
+	for _, name := range credentialHeaders {
+		h.Write([]byte{0})
+		h.Write([]byte(req.Header.Get(name)))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeCacheFile writes a cache file readable only by the user, since cached
+// responses may come from private projects. Errors are ignored; a missing
+// cache entry only costs a full request.
+func writeCacheFile(file string, b []byte) {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".tmp-")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(b)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	os.Rename(tmp.Name(), file)
+}
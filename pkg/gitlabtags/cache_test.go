@@ -0,0 +1,129 @@
+package gitlabtags
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCacheTransport(t *testing.T) {
+	tests := []struct {
+		name       string
+		ttl        time.Duration
+		revalidate bool
+		etag       string
+		tokens     []string // of each request
+		wantHits   int      // requests the server answers in full
+		wantIfNone int      // requests revalidated with If-None-Match
+	}{
+		{"not cached", 0, false, `"v1"`, []string{"", ""}, 2, 0},
+		{"fresh within ttl", time.Hour, false, "", []string{"", "", ""}, 1, 0},
+		{"revalidated", 0, true, `"v1"`, []string{"", "", ""}, 1, 2},
+		{"revalidation needs an etag", 0, true, "", []string{"", ""}, 2, 0},
+		{"fresh before revalidating", time.Hour, true, `"v1"`, []string{"", ""}, 1, 0},
+		{"tokens not shared", time.Hour, false, "", []string{"a", "b", "a"}, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits, ifNone := 0, 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.etag != "" && r.Header.Get("If-None-Match") == tt.etag {
+					ifNone++
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				hits++
+				if tt.etag != "" {
+					w.Header().Set("ETag", tt.etag)
+				}
+				w.Write([]byte(`[{"name":"v1.0.0"}]`))
+			}))
+			defer srv.Close()
+			ct := &CacheTransport{Base: srv.Client().Transport, Dir: t.TempDir(), TTL: tt.ttl, Revalidate: tt.revalidate}
+			for _, token := range tt.tokens {
+				req, _ := http.NewRequest("GET", srv.URL+"/api/v4/projects/g%2Fp/repository/tags", nil)
+				if token != "" {
+					req.Header.Set("PRIVATE-TOKEN", token)
+				}
+				resp, err := ct.RoundTrip(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, _ := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK || string(body) != `[{"name":"v1.0.0"}]` {
+					t.Fatalf("got %d %q, want the listing", resp.StatusCode, body)
+				}
+			}
+			if hits != tt.wantHits {
+				t.Errorf("server answered %d requests in full, want %d", hits, tt.wantHits)
+			}
+			if ifNone != tt.wantIfNone {
+				t.Errorf("server revalidated %d requests, want %d", ifNone, tt.wantIfNone)
+			}
+		})
+	}
+}
+
+func TestCacheTransportSkips(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		status int
+	}{
+		{"post", "POST", http.StatusOK},
+		{"error response", "GET", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hits++
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+			ct := &CacheTransport{Base: srv.Client().Transport, Dir: t.TempDir(), TTL: time.Hour}
+			for i := 0; i < 2; i++ {
+				req, _ := http.NewRequest(tt.method, srv.URL+"/", nil)
+				resp, err := ct.RoundTrip(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+			}
+			if hits != 2 {
+				t.Errorf("server got %d requests, want 2", hits)
+			}
+		})
+	}
+}
+
+func TestCachedProjects(t *testing.T) {
+	dir := t.TempDir()
+	ct := &CacheTransport{
+		Base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return response(req, 200, nil, "[]"), nil
+		}),
+		Dir: dir,
+		TTL: time.Hour,
+	}
+	for _, u := range []string{
+		"https://gitlab.example.com/api/v4/projects/g%2Fp/repository/tags",
+		"https://gitlab.example.com/api/v4/projects/g%2Fp/repository/tags?page=2",
+		"https://gitlab.example.com/api/v4/projects/a%2Fsub%2Fq/repository/tags",
+		"https://gitlab.example.com/api/v4/projects/42/repository/tags",
+		"https://gitlab.example.com/api/v4/version",
+	} {
+		req, _ := http.NewRequest("GET", u, nil)
+		if _, err := ct.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"a/sub/q", "g/p"}
+	if got := CachedProjects(dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("CachedProjects() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,1100 @@
+// Package gitlabtags lists the tags of a GitLab project using the GitLab API,
+// optionally parsing, sorting, and filtering them by semantic version.
+package gitlabtags
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/blang/semver"
+)
+
+// perPage is the number of tags requested from the API per page; 100 is the
+// maximum GitLab allows.
+const perPage = 100
+
+func init() {
+	Register("gitlab", func(cfg Config) (Provider, error) {
+		switch {
+		case cfg.JobToken:
+			return NewJobTokenClient(cfg.BaseURL, cfg.Token, cfg.HTTPClient)
+		case cfg.OAuthToken:
+			return NewOAuthClient(cfg.BaseURL, cfg.Token, cfg.HTTPClient)
+		}
+		return NewClient(cfg.BaseURL, cfg.Token, cfg.HTTPClient)
+	})
+}
+
+// Client retrieves tags from a GitLab instance.
+type Client struct {
+	baseURL     *url.URL
+	token       string
+	tokenHeader string
+	httpClient  *http.Client
+
+	// v3 is set to 1 once the instance is found to predate API v4.
+	v3 int32
+}
+
+// NewClient returns a Client for the GitLab instance at baseURL (e.g.
+// https://gitlab.example.com/), authenticating with the personal access token
+// if it is not empty. If httpClient is nil, http.DefaultClient is used.
+func NewClient(baseURL, token string, httpClient *http.Client) (*Client, error) {
+	if baseURL == "" {
+		return nil, errors.New("the GitLab url is required")
+	}
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing url %s: %w", baseURL, err)
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{baseURL: u, token: token, tokenHeader: "PRIVATE-TOKEN", httpClient: httpClient}, nil
+}
+
+// NewJobTokenClient is like NewClient, but authenticates with the CI_JOB_TOKEN
+// of a GitLab CI job instead of a personal access token.
+func NewJobTokenClient(baseURL, jobToken string, httpClient *http.Client) (*Client, error) {
+	c, err := NewClient(baseURL, jobToken, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	c.tokenHeader = "JOB-TOKEN"
+	return c, nil
+}
+
+// NewOAuthClient is like NewClient, but authenticates with an OAuth access
+// token instead of a personal access token.
+func NewOAuthClient(baseURL, accessToken string, httpClient *http.Client) (*Client, error) {
+	c, err := NewClient(baseURL, "Bearer "+accessToken, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	c.tokenHeader = "Authorization"
+	return c, nil
+}
+
+// BaseURL returns the base URL of the GitLab instance, with a trailing slash.
+func (c *Client) BaseURL() string {
+	return c.baseURL.String()
+}
+
+// ListOptions controls which tags ListTags returns and in what order.
+type ListOptions struct {
+	// MaxTags caps the number of tags retrieved from the API; 0 retrieves
+	// all pages.
+	MaxTags int
+
+	// TagPrefix keeps only the tags whose names start with it, such as
+	// "servicefoo/" for the tags of one component of a monorepo. It is
+	// removed from the names before their versions are parsed.
+	TagPrefix string
+
+	// StripPrefixes are removed from the start of tag names, after
+	// TagPrefix, before their versions are parsed; the longest that matches
+	// is removed. If it is nil, DefaultStripPrefixes are used.
+	StripPrefixes []string
+
+	// Search keeps only the tags whose names contain it, or start with it
+	// after a leading "^", or end with it before a trailing "$". GitLab
+	// filters the tags itself, so that only the matching ones are
+	// retrieved; TagPrefix is searched for in the same way when Search is
+	// empty.
+	Search string
+
+	// Match, if it is not nil, drops the tags whose names it does not match,
+	// before their versions are parsed.
+	Match *regexp.Regexp
+
+	// Exclude drops the tags whose names any of its expressions match,
+	// before their versions are parsed.
+	Exclude []*regexp.Regexp
+
+	// AnnotatedOnly drops the lightweight tags, such as deploy markers,
+	// keeping the annotated ones, before their versions are parsed.
+	AnnotatedOnly bool
+
+	// SortSemver parses each tag name as a semantic version, sorts the tags
+	// most recent first, and drops tags older than Since.
+	SortSemver bool
+
+	// ParseVersion, if it is not nil, parses the versions in the tag names
+	// when SortSemver is set, instead of semver.Make: e.g. CoerceVersion,
+	// for names that are almost semantic versions, or ParseCalVer.
+	ParseVersion VersionParser
+
+	// Since is the oldest version returned when SortSemver is set.
+	Since semver.Version
+
+	// Until, if it is not the zero Version, is the most recent version
+	// returned when SortSemver is set.
+	Until semver.Version
+
+	// StableOnly drops the tags whose version has a pre-release part (e.g.
+	// 1.0.0-rc.1) when SortSemver is set.
+	StableOnly bool
+
+	// SortByDate sorts the tags by the date of their commit, most recent
+	// first, instead of by version. Versions are still parsed and Since
+	// applied if SortSemver is set.
+	SortByDate bool
+
+	// SortByName sorts the tags by name with CompareNatural, the greatest
+	// first, instead of by version or date, for names that are not
+	// versions. Versions are still parsed and Since applied if SortSemver
+	// is set.
+	SortByName bool
+
+	// Ascending reverses the order of the tags, so that with SortSemver,
+	// SortByDate, or SortByName the oldest come first.
+	Ascending bool
+
+	// OrderBy has the host sort the tags, by "name", "updated", or
+	// "version", in the direction given by Ascending, and leaves them in
+	// that order: SortSemver still parses versions and filters the tags,
+	// but does not sort them, and SortByDate and SortByName are ignored.
+	// Hosts that cannot sort tags return ErrNotSupported. It is ignored
+	// with Releases.
+	OrderBy string
+
+	// MemoryTags, if it is positive, is the most tags StreamTags holds in
+	// memory while sorting them; the rest are kept in temporary files.
+	MemoryTags int
+
+	// Limit caps the number of tags returned, after sorting and filtering;
+	// 0 returns them all. When the tags need not be sorted, no more pages
+	// are retrieved than are needed for Limit tags.
+	Limit int
+
+	// Concurrency is the number of pages fetched at once when the host
+	// reports the total number of pages; 0 or 1 fetches them one by one.
+	Concurrency int
+
+	// Signatures fetches the signature of each tag's commit, setting
+	// Signature. Hosts that cannot verify signatures return ErrNotSupported.
+	Signatures bool
+
+	// Releases lists only the tags with a release, using the Releases API so
+	// that each tag's Release is complete and its Message is the release
+	// description. Hosts without releases return ErrNotSupported.
+	Releases bool
+}
+
+// fetchLimit returns the number of tags that need to be retrieved from the
+// API, or 0 if all of them do.
+func (o ListOptions) fetchLimit() int {
+	max := o.MaxTags
+	sorted := o.OrderBy != "" || (!o.SortByDate && !o.SortByName && !o.Ascending)
+	if o.Limit > 0 && o.TagPrefix == "" && o.Search == "" && o.Match == nil && len(o.Exclude) == 0 && !o.AnnotatedOnly && !o.SortSemver && sorted && (max == 0 || o.Limit < max) {
+		max = o.Limit
+	}
+	return max
+}
+
+// streamable reports whether the tags can be selected and passed on page by
+// page, as by StreamTags: whether they are left in the order the host returns
+// them, and are not listed from releases.
+func (o ListOptions) streamable() bool {
+	return !o.Releases && (o.OrderBy != "" || (!o.SortSemver && !o.SortByDate && !o.SortByName && !o.Ascending))
+}
+
+// query returns the query parameters that have GitLab search for the tags
+// and sort them as the options ask.
+func (o ListOptions) query() url.Values {
+	q := url.Values{}
+	switch {
+	case o.Search != "":
+		q.Set("search", o.Search)
+	case o.TagPrefix != "":
+		q.Set("search", "^"+o.TagPrefix)
+	}
+	if o.OrderBy != "" {
+		sort := "desc"
+		if o.Ascending {
+			sort = "asc"
+		}
+		q.Set("order_by", o.OrderBy)
+		q.Set("sort", sort)
+	}
+	return q
+}
+
+// ListTags returns the tags of project, given as its full path (e.g.
+// "group/project"). When opts.SortSemver is set, tags whose names cannot be
+// parsed are still returned, with a zero Version, and their parse errors are
+// returned in errs alongside a nil err.
+func (c *Client) ListTags(ctx context.Context, project string, opts ListOptions) (tags Tags, errs []error, err error) {
+	ctx, end := startSpan(ctx, "ListTags", "project", project)
+	defer func() { end(err) }()
+	if opts.Releases {
+		opts.OrderBy = ""
+		tags, err = c.fetchReleaseTags(ctx, project, opts.fetchLimit())
+	} else {
+		tags, err = c.fetchTags(ctx, project, opts.fetchLimit(), opts.Concurrency, opts.query())
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	tags, errs = SelectTags(tags, opts)
+	if opts.Signatures {
+		if err := c.fetchSignatures(ctx, project, tags, opts.Concurrency); err != nil {
+			return nil, nil, err
+		}
+	}
+	return tags, errs, nil
+}
+
+// StreamTags is like ListTags, but calls fn with the selected tags as they
+// are retrieved, so that the tags need not all be held in memory. Pages are
+// fetched one at a time, whatever opts.Concurrency is. When the tags are left
+// in the order GitLab returns them, fn is called with those of each page as
+// soon as it is retrieved; otherwise they are sorted first, holding up to
+// opts.MemoryTags in memory and the rest in temporary files, and passed on a
+// page's worth at a time. It returns ErrNotSupported for tags listed from
+// releases.
+func (c *Client) StreamTags(ctx context.Context, project string, opts ListOptions, fn func(Tags) error) (errs []error, err error) {
+	if opts.Releases {
+		return nil, ErrNotSupported
+	}
+	ctx, end := startSpan(ctx, "StreamTags", "project", project)
+	defer func() { end(err) }()
+	u, err := c.tagsURL(project, opts.query())
+	if err != nil {
+		return nil, err
+	}
+	max, limit := opts.fetchLimit(), opts.Limit
+
+	// Sorted tags are passed on once all are retrieved, with their
+	// signatures fetched only for the ones within the limit.
+	var sorter *tagSorter
+	emit := func(tags Tags) error {
+		if opts.Signatures {
+			if err := c.fetchSignatures(ctx, project, tags, opts.Concurrency); err != nil {
+				return err
+			}
+		}
+		return fn(tags)
+	}
+	if !opts.streamable() {
+		sorter = newTagSorter(opts, opts.MemoryTags)
+		defer sorter.close()
+		// The pages are only filtered; the sorter orders the tags.
+		opts.SortByDate, opts.Ascending, opts.Limit = false, false, 0
+	}
+
+	fetched, selected := 0, 0
+	for page := 1; ; {
+		tags, header, err := c.fetchTagsPage(ctx, *u, page)
+		if err != nil && page == 1 && c.fallBackToV3(ctx, err) {
+			if u, err = c.tagsURL(project, opts.query()); err != nil {
+				return nil, err
+			}
+			tags, header, err = c.fetchTagsPage(ctx, *u, page)
+		}
+		if err != nil {
+			return nil, err
+		}
+		n := len(tags)
+		if max > 0 && fetched+n > max {
+			tags = tags[:max-fetched]
+		}
+		fetched += len(tags)
+
+		if limit > 0 && sorter == nil {
+			opts.Limit = limit - selected
+		}
+		tags, pageErrs := SelectTags(tags, opts)
+		errs = append(errs, pageErrs...)
+		if sorter != nil {
+			if err := sorter.add(tags); err != nil {
+				return nil, err
+			}
+		} else if len(tags) > 0 {
+			if err := emit(tags); err != nil {
+				return nil, err
+			}
+			selected += len(tags)
+		}
+
+		// An empty page means we have read past the end, as in fetchTags.
+		next := header.Get("X-Next-Page")
+		if next == "" || n == 0 || (max > 0 && fetched >= max) || (limit > 0 && selected >= limit) {
+			break
+		}
+		if page, err = strconv.Atoi(next); err != nil {
+			return nil, fmt.Errorf("invalid X-Next-Page header %q", next)
+		}
+	}
+	if sorter != nil {
+		if err := sorter.merge(limit, perPage, emit); err != nil {
+			return nil, err
+		}
+	}
+	return errs, nil
+}
+
+// fetchSignatures sets the Signature of each tag, fetching up to concurrency
+// at a time.
+func (c *Client) fetchSignatures(ctx context.Context, project string, tags Tags, concurrency int) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The first error is returned, rather than those of the requests it
+	// canceled.
+	var (
+		mu       sync.Mutex
+		firstErr error
+	)
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency && w < len(tags); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				sig, err := c.commitSignature(ctx, project, tags[i].Commit.ID)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					cancel()
+					continue
+				}
+				tags[i].Signature = sig
+			}
+		}()
+	}
+	for i := range tags {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	return firstErr
+}
+
+// commitSignature returns the signature of the commit with the given ID.
+func (c *Client) commitSignature(ctx context.Context, project, id string) (*Signature, error) {
+	var sig struct {
+		SignatureType      string `json:"signature_type"`
+		VerificationStatus string `json:"verification_status"`
+	}
+	_, err := c.getJSON(ctx, c.projectURL(project, "/repository/commits/"+url.PathEscape(id)+"/signature"), &sig)
+	var se *StatusError
+	if errors.As(err, &se) && se.StatusCode == http.StatusNotFound {
+		return &Signature{Status: SignatureUnsigned}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Signature{Type: sig.SignatureType, Status: sig.VerificationStatus}, nil
+}
+
+// SelectTags applies the semantic version parsing, sorting, and filtering
+// requested by opts to tags retrieved from any host, or obtained some other
+// way, such as from a webhook.
+func SelectTags(tags Tags, opts ListOptions) (Tags, []error) {
+	if opts.TagPrefix != "" {
+		tags = HasPrefix(tags, opts.TagPrefix)
+	}
+	if opts.Search != "" {
+		tags = Search(tags, opts.Search)
+	}
+	if opts.Match != nil {
+		tags = Match(tags, opts.Match)
+	}
+	if len(opts.Exclude) > 0 {
+		tags = Exclude(tags, opts.Exclude...)
+	}
+	if opts.AnnotatedOnly {
+		tags = AnnotatedOnly(tags)
+	}
+	var errs []error
+	if opts.SortSemver {
+		strip := opts.StripPrefixes
+		if strip == nil {
+			strip = DefaultStripPrefixes
+		}
+		parse := opts.ParseVersion
+		if parse == nil {
+			parse = semver.Make
+		}
+		errs = ParseVersionsWith(tags, opts.TagPrefix, strip, parse)
+		if opts.OrderBy == "" {
+			Sort(tags)
+		}
+		tags = Since(tags, opts.Since)
+		if !opts.Until.Equals(semver.Version{}) {
+			tags = Until(tags, opts.Until)
+		}
+		if opts.StableOnly {
+			tags = Stable(tags)
+		}
+	}
+	if opts.OrderBy == "" {
+		switch {
+		case opts.SortByName:
+			SortByName(tags)
+		case opts.SortByDate:
+			SortByDate(tags)
+		}
+		if opts.Ascending {
+			Reverse(tags)
+		}
+	}
+	if opts.Limit > 0 && len(tags) > opts.Limit {
+		tags = tags[:opts.Limit]
+	}
+	return tags, errs
+}
+
+// ErrInvalidResponse is returned when the API responds with something other
+// than a JSON array of tags.
+var ErrInvalidResponse = errors.New("response was not valid; if this is a private repo, did you specify a token?")
+
+// maxErrorBody is how much of the body of an unsuccessful or invalid response
+// is kept for its error.
+const maxErrorBody = 4 << 10
+
+// StatusError is returned when the API responds with an unsuccessful status.
+// It wraps ErrInvalidResponse.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s\nResponse: %s %s", ErrInvalidResponse, e.Status, e.Body)
+}
+
+func (e *StatusError) Unwrap() error { return ErrInvalidResponse }
+
+// fetchTags retrieves every page of tags for project, until the last page is
+// reached or max is hit. Once the first page reports the total number of
+// pages in X-Total-Pages, the remaining pages are fetched by up to
+// concurrency requests at a time; otherwise the X-Next-Page header is
+// followed one page at a time. The query parameters in query, if any, are
+// added to each request.
+func (c *Client) fetchTags(ctx context.Context, project string, max, concurrency int, query url.Values) (Tags, error) {
+	u, err := c.tagsURL(project, query)
+	if err != nil {
+		return nil, err
+	}
+
+	all, header, err := c.fetchTagsPage(ctx, *u, 1)
+	if err != nil && c.fallBackToV3(ctx, err) {
+		if u, err = c.tagsURL(project, query); err != nil {
+			return nil, err
+		}
+		all, header, err = c.fetchTagsPage(ctx, *u, 1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if max > 0 && len(all) >= max {
+		return all[:max], nil
+	}
+
+	if total, err := strconv.Atoi(header.Get("X-Total-Pages")); err == nil && concurrency > 1 {
+		if max > 0 {
+			if need := (max + perPage - 1) / perPage; need < total {
+				total = need
+			}
+		}
+		rest, err := c.fetchTagsPages(ctx, *u, 2, total, concurrency)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, rest...)
+		if max > 0 && len(all) > max {
+			all = all[:max]
+		}
+		return all, nil
+	}
+
+	// An empty page means we have read past the end, whether or not the
+	// server sent pagination headers.
+	next := header.Get("X-Next-Page")
+	for next != "" && len(all) > 0 {
+		page, err := strconv.Atoi(next)
+		if err != nil {
+			return nil, fmt.Errorf("invalid X-Next-Page header %q", next)
+		}
+		tags, h, err := c.fetchTagsPage(ctx, *u, page)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, tags...)
+		if max > 0 && len(all) >= max {
+			return all[:max], nil
+		}
+		if len(tags) == 0 {
+			break
+		}
+		next = h.Get("X-Next-Page")
+	}
+	return all, nil
+}
+
+// tagsURL returns the API URL of project's tags, with the query parameters
+// in query.
+func (c *Client) tagsURL(project string, query url.Values) (*url.URL, error) {
+	u, err := url.Parse(c.projectURL(project, "/repository/tags"))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing url for project %s: %w", project, err)
+	}
+	u.RawQuery = query.Encode()
+	return u, nil
+}
+
+// fetchTagsPages fetches pages first through last of the tags endpoint u with
+// a pool of concurrency workers, returning the tags in page order.
+func (c *Client) fetchTagsPages(ctx context.Context, u url.URL, first, last, concurrency int) (Tags, error) {
+	if last < first {
+		return nil, nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The first error is returned, rather than those of the requests it
+	// canceled.
+	pages := make([]Tags, last-first+1)
+	var (
+		mu       sync.Mutex
+		firstErr error
+	)
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency && w < len(pages); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				tags, _, err := c.fetchTagsPage(ctx, u, first+i)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					cancel()
+					continue
+				}
+				pages[i] = tags
+			}
+		}()
+	}
+	for i := range pages {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	var all Tags
+	for _, tags := range pages {
+		all = append(all, tags...)
+	}
+	return all, nil
+}
+
+// fetchTagsPage retrieves one page of the tags endpoint u, in a span of its
+// own.
+func (c *Client) fetchTagsPage(ctx context.Context, u url.URL, page int) (Tags, http.Header, error) {
+	ctx, end := startSpan(ctx, "tags page", "page", strconv.Itoa(page))
+	tags, header, err := c.getTagsPage(ctx, u, page)
+	end(err)
+	return tags, header, err
+}
+
+// getTagsPage retrieves one page of the tags endpoint u.
+func (c *Client) getTagsPage(ctx context.Context, u url.URL, page int) (Tags, http.Header, error) {
+	q := u.Query()
+	q.Set("per_page", strconv.Itoa(perPage))
+	q.Set("page", strconv.Itoa(page))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating request for url %s: %w", u.String(), err)
+	}
+	if c.token != "" {
+		req.Header.Add(c.tokenHeader, c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting url %s: %w", u.String(), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, nil, statusError(resp)
+	}
+
+	// Decode the array a tag at a time, rather than reading the whole page
+	// first.
+	body, err := jsonBody(resp, "[")
+	if err != nil {
+		return nil, nil, err
+	}
+	dec := json.NewDecoder(body)
+	if _, err := dec.Token(); err != nil {
+		return nil, nil, fmt.Errorf("error decoding json for url %s: %w", u.String(), err)
+	}
+	var tags Tags
+	for dec.More() {
+		var tag Tag
+		if err := dec.Decode(&tag); err != nil {
+			return nil, nil, fmt.Errorf("error decoding json for url %s: %w", u.String(), err)
+		}
+		tags = append(tags, tag)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, nil, fmt.Errorf("error decoding json for url %s: %w", u.String(), err)
+	}
+	for i := range tags {
+		if r := tags[i].Release; tags[i].Message == "" && r != nil {
+			tags[i].Message = r.Description
+		}
+	}
+	if atomic.LoadInt32(&c.v3) == 1 {
+		for i := range tags {
+			fillV3Commit(&tags[i].Commit)
+		}
+	}
+	return tags, resp.Header, nil
+}
+
+// fallBackToV3 reports whether err, returned by a request to API v4, is
+// because the instance is too old to have it, in which case later requests
+// are made to API v3 instead. Such instances answer 404 or 410 to every v4
+// URL, including /api/v4/version, which newer ones always serve.
+func (c *Client) fallBackToV3(ctx context.Context, err error) bool {
+	var se *StatusError
+	if atomic.LoadInt32(&c.v3) == 1 || !errors.As(err, &se) ||
+		(se.StatusCode != http.StatusNotFound && se.StatusCode != http.StatusGone) {
+		return false
+	}
+	_, err = c.getJSON(ctx, c.baseURL.String()+"api/v4/version", nil)
+	if !errors.As(err, &se) || (se.StatusCode != http.StatusNotFound && se.StatusCode != http.StatusGone) {
+		return false
+	}
+	atomic.StoreInt32(&c.v3, 1)
+	return true
+}
+
+// fillV3Commit fills in the fields of a commit from API v3 that only API v4
+// reports, from the ones both do.
+func fillV3Commit(commit *Commit) {
+	if commit.ShortID == "" && len(commit.ID) >= 8 {
+		commit.ShortID = commit.ID[:8]
+	}
+	if commit.Title == "" {
+		commit.Title = strings.SplitN(commit.Message, "\n", 2)[0]
+	}
+	if commit.CreatedAt.IsZero() {
+		commit.CreatedAt = commit.CommittedDate
+	}
+	if commit.CreatedAt.IsZero() {
+		commit.CreatedAt = commit.AuthoredDate
+	}
+}
+
+// apiPath returns the path of the API relative to the base URL: "api/v4/",
+// or "api/v3/" for instances that predate API v4.
+func (c *Client) apiPath() string {
+	if atomic.LoadInt32(&c.v3) == 1 {
+		return "api/v3/"
+	}
+	return "api/v4/"
+}
+
+// escapeSegments escapes each segment of a project path such as
+// "group/subgroup/project" for use in the path of a web UI URL.
+func escapeSegments(project string) string {
+	segments := strings.Split(project, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// projectURL returns the API URL of project, with path appended. The
+// project's full path (e.g. "group/subgroup/project") is escaped as a single
+// segment, as the API requires.
+func (c *Client) projectURL(project, path string) string {
+	return c.baseURL.String() + c.apiPath() + "projects/" + url.PathEscape(project) + path
+}
+
+// getJSON decodes the JSON response from u into v.
+func (c *Client) getJSON(ctx context.Context, u string, v interface{}) (http.Header, error) {
+	return c.doJSON(ctx, "GET", u, nil, v)
+}
+
+// doJSON makes a request to u with body, if it is not nil, encoded as JSON,
+// and decodes the JSON response into v.
+func (c *Client) doJSON(ctx context.Context, method, u string, body, v interface{}) (http.Header, error) {
+	if body == nil {
+		return c.send(ctx, method, u, "", nil, v)
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(ctx, method, u, "application/json", bytes.NewReader(b), v)
+}
+
+// send makes a request to u with body of type contentType, if it is not nil,
+// and decodes the JSON response into v.
+func (c *Client) send(ctx context.Context, method, u, contentType string, body io.Reader, v interface{}) (http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request for url %s: %w", u, err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return c.do(req, v)
+}
+
+// do makes req, authenticated with the client's token, and decodes the JSON
+// response into v, unless v is nil.
+func (c *Client) do(req *http.Request, v interface{}) (http.Header, error) {
+	u := req.URL.String()
+	if c.token != "" {
+		req.Header.Add(c.tokenHeader, c.token)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error getting url %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, statusError(resp)
+	}
+	if v == nil {
+		return resp.Header, nil
+	}
+	body, err := jsonBody(resp, "[{")
+	if err != nil {
+		return nil, err
+	}
+	if err := json.NewDecoder(body).Decode(v); err != nil {
+		return nil, fmt.Errorf("error decoding json for url %s: %w", u, err)
+	}
+	return resp.Header, nil
+}
+
+// statusError returns the error for resp, which has an unsuccessful status,
+// holding the start of its body.
+func statusError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	return &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(bytes.TrimSpace(body))}
+}
+
+// jsonBody returns the body of resp, if it starts with one of the characters
+// in open, as a JSON array or object does. Otherwise, as for an HTML login
+// page served by a proxy in place of the API, it returns an error wrapping
+// ErrInvalidResponse with the content type and start of the body.
+func jsonBody(resp *http.Response, open string) (io.Reader, error) {
+	r := bufio.NewReaderSize(resp.Body, maxErrorBody)
+	start, _ := r.Peek(maxErrorBody)
+	trimmed := bytes.TrimLeft(start, " \t\r\n")
+	if len(trimmed) > 0 && strings.IndexByte(open, trimmed[0]) >= 0 {
+		return r, nil
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "no content type"
+	}
+	if len(trimmed) == 0 {
+		return nil, fmt.Errorf("%w\nResponse: %s with an empty body (%s)", ErrInvalidResponse, resp.Status, contentType)
+	}
+	return nil, fmt.Errorf("%w\nResponse: %s (%s) %s", ErrInvalidResponse, resp.Status, contentType, bytes.TrimSpace(start))
+}
+
+// ListReleases returns the releases of project, most recent first.
+func (c *Client) ListReleases(ctx context.Context, project string) ([]Release, error) {
+	var all []Release
+	page := "1"
+	for page != "" {
+		var releases []Release
+		u := c.projectURL(project, "/releases") + "?per_page=" + strconv.Itoa(perPage) + "&page=" + page
+		header, err := c.getJSON(ctx, u, &releases)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, releases...)
+		if len(releases) == 0 {
+			break
+		}
+		page = header.Get("X-Next-Page")
+	}
+	return all, nil
+}
+
+// CreateRelease publishes release from the existing tag release.TagName.
+func (c *Client) CreateRelease(ctx context.Context, project string, release Release) (*Release, error) {
+	type link struct {
+		Name     string `json:"name"`
+		URL      string `json:"url"`
+		LinkType string `json:"link_type,omitempty"`
+	}
+	req := struct {
+		TagName     string `json:"tag_name"`
+		Name        string `json:"name,omitempty"`
+		Description string `json:"description"`
+		Assets      struct {
+			Links []link `json:"links,omitempty"`
+		} `json:"assets"`
+	}{TagName: release.TagName, Name: release.Name, Description: release.Description}
+	for _, l := range release.Assets.Links {
+		req.Assets.Links = append(req.Assets.Links, link(l))
+	}
+	var created Release
+	if _, err := c.doJSON(ctx, "POST", c.projectURL(project, "/releases"), req, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UploadAsset uploads content to project as a file called name, returning
+// the link to attach it to a release with. If content is a file, it is
+// streamed rather than read into memory.
+func (c *Client) UploadAsset(ctx context.Context, project, name string, content io.Reader) (ReleaseLink, error) {
+	var head, tail bytes.Buffer
+	mw := multipart.NewWriter(&head)
+	if _, err := mw.CreateFormFile("file", name); err != nil {
+		return ReleaseLink{}, err
+	}
+	ct := mw.FormDataContentType()
+	tail.WriteString("\r\n--" + mw.Boundary() + "--\r\n")
+
+	u := c.projectURL(project, "/uploads")
+	req, err := http.NewRequestWithContext(ctx, "POST", u, io.MultiReader(&head, content, &tail))
+	if err != nil {
+		return ReleaseLink{}, fmt.Errorf("error creating request for url %s: %w", u, err)
+	}
+	req.Header.Set("Content-Type", ct)
+	if f, ok := content.(interface{ Stat() (os.FileInfo, error) }); ok {
+		if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+			req.ContentLength = int64(head.Len()) + fi.Size() + int64(tail.Len())
+		}
+	}
+
+	var upload struct {
+		URL      string `json:"url"`
+		FullPath string `json:"full_path"`
+	}
+	if _, err := c.do(req, &upload); err != nil {
+		return ReleaseLink{}, err
+	}
+	// Older versions of GitLab give only the URL relative to the project.
+	link := strings.TrimPrefix(upload.FullPath, "/")
+	if link == "" {
+		link = escapeSegments(project) + upload.URL
+	}
+	return ReleaseLink{Name: name, URL: c.baseURL.String() + link}, nil
+}
+
+// Project returns the project with the given ID. Any method taking a project
+// path also accepts the project's ID.
+func (c *Client) Project(ctx context.Context, id string) (*Project, error) {
+	var p Project
+	if _, err := c.getJSON(ctx, c.projectURL(id, ""), &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ListGroupProjects returns the projects in group, given as its full path,
+// and in its subgroups too if subgroups is set, ordered by path.
+func (c *Client) ListGroupProjects(ctx context.Context, group string, subgroups bool) ([]Project, error) {
+	q := url.Values{"include_subgroups": {strconv.FormatBool(subgroups)}}
+	return c.listProjects(ctx, c.apiPath()+"groups/"+url.PathEscape(group)+"/projects", q)
+}
+
+// SearchProjects returns the projects whose name or full path contains query,
+// ordered by path.
+func (c *Client) SearchProjects(ctx context.Context, query string) ([]Project, error) {
+	q := url.Values{
+		"search":            {query},
+		"search_namespaces": {"true"},
+		"simple":            {"true"},
+	}
+	return c.listProjects(ctx, c.apiPath()+"projects", q)
+}
+
+// listProjects returns every page of the projects listed at path, relative
+// to the base URL, with the query parameters q, ordered by path.
+func (c *Client) listProjects(ctx context.Context, path string, q url.Values) ([]Project, error) {
+	q.Set("order_by", "path")
+	q.Set("sort", "asc")
+	q.Set("per_page", strconv.Itoa(perPage))
+	var all []Project
+	page := "1"
+	for page != "" {
+		var projects []Project
+		q.Set("page", page)
+		header, err := c.getJSON(ctx, c.baseURL.String()+path+"?"+q.Encode(), &projects)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, projects...)
+		if len(projects) == 0 {
+			break
+		}
+		page = header.Get("X-Next-Page")
+	}
+	return all, nil
+}
+
+// ListProtectedTags returns project's protected tag patterns.
+func (c *Client) ListProtectedTags(ctx context.Context, project string) ([]ProtectedTag, error) {
+	var all []ProtectedTag
+	page := "1"
+	for page != "" {
+		var tags []ProtectedTag
+		u := c.projectURL(project, "/protected_tags") + "?per_page=" + strconv.Itoa(perPage) + "&page=" + page
+		header, err := c.getJSON(ctx, u, &tags)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, tags...)
+		if len(tags) == 0 {
+			break
+		}
+		page = header.Get("X-Next-Page")
+	}
+	return all, nil
+}
+
+// DeleteTag deletes the tag called tag from project.
+func (c *Client) DeleteTag(ctx context.Context, project, tag string) error {
+	_, err := c.send(ctx, "DELETE", c.projectURL(project, "/repository/tags/"+url.PathEscape(tag)), "", nil, nil)
+	return err
+}
+
+// fetchReleaseTags returns the tags of project's releases, up to max if it is
+// not 0.
+func (c *Client) fetchReleaseTags(ctx context.Context, project string, max int) (Tags, error) {
+	releases, err := c.ListReleases(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	if max > 0 && len(releases) > max {
+		releases = releases[:max]
+	}
+	tags := make(Tags, len(releases))
+	for i := range releases {
+		r := &releases[i]
+		tags[i] = Tag{Name: r.TagName, Message: r.Description, Commit: r.Commit, Release: r}
+	}
+	return tags, nil
+}
+
+// CompareRefs returns the commits reachable from to but not from from.
+func (c *Client) CompareRefs(ctx context.Context, project, from, to string) (*Comparison, error) {
+	var resp struct {
+		Commits []Commit `json:"commits"`
+	}
+	u := c.projectURL(project, "/repository/compare") + "?" + url.Values{"from": {from}, "to": {to}}.Encode()
+	if _, err := c.getJSON(ctx, u, &resp); err != nil {
+		return nil, err
+	}
+	return &Comparison{Commits: resp.Commits}, nil
+}
+
+// MergeRequest returns the merge request with the given IID in project.
+func (c *Client) MergeRequest(ctx context.Context, project string, iid int) (*MergeRequest, error) {
+	var mr MergeRequest
+	if _, err := c.getJSON(ctx, c.projectURL(project, "/merge_requests/"+strconv.Itoa(iid)), &mr); err != nil {
+		return nil, err
+	}
+	return &mr, nil
+}
+
+// GenerateChangelog returns the notes for version, covering the commits
+// reachable from to but not from from, as generated by GitLab (14.6 or later)
+// from the Changelog trailers of the commits. The notes are only generated;
+// unlike a POST to the same endpoint, nothing is committed to the repository.
+// Before 14.6, the endpoint only accepts POST, and GET fails with a
+// StatusError for 404 Not Found.
+func (c *Client) GenerateChangelog(ctx context.Context, project, version, from, to string) (string, error) {
+	var resp struct {
+		Notes string `json:"notes"`
+	}
+	q := url.Values{"version": {version}, "from": {from}, "to": {to}}
+	if _, err := c.getJSON(ctx, c.projectURL(project, "/repository/changelog")+"?"+q.Encode(), &resp); err != nil {
+		return "", err
+	}
+	return resp.Notes, nil
+}
+
+// UserByEmail returns the user with the given email address, or nil if there
+// is none the token can see. Only administrators can find users by their
+// private email addresses.
+func (c *Client) UserByEmail(ctx context.Context, email string) (*User, error) {
+	var users []User
+	u := c.baseURL.String() + c.apiPath() + "users?" + url.Values{"search": {email}}.Encode()
+	if _, err := c.getJSON(ctx, u, &users); err != nil {
+		return nil, err
+	}
+	if len(users) != 1 {
+		return nil, nil
+	}
+	return &users[0], nil
+}
+
+// TagsURL returns the URL of the page listing project's tags.
+func (c *Client) TagsURL(project string) string {
+	return c.baseURL.String() + escapeSegments(project) + "/-/tags"
+}
+
+// TagURL returns the URL of the page for tag.
+func (c *Client) TagURL(project, tag string) string {
+	return c.TagsURL(project) + "/" + url.PathEscape(tag)
+}
+
+// CompareURL returns the URL of the page comparing from with to.
+func (c *Client) CompareURL(project, from, to string) string {
+	return c.baseURL.String() + escapeSegments(project) + "/-/compare/" + url.PathEscape(from) + "..." + url.PathEscape(to)
+}
+
+// IssueURL returns the URL of the page for the issue with the given IID in
+// project.
+func (c *Client) IssueURL(project string, iid int) string {
+	return c.baseURL.String() + escapeSegments(project) + "/-/issues/" + strconv.Itoa(iid)
+}
+
+// MergeRequestURL returns the URL of the page for the merge request with the
+// given IID in project.
+func (c *Client) MergeRequestURL(project string, iid int) string {
+	return c.baseURL.String() + escapeSegments(project) + "/-/merge_requests/" + strconv.Itoa(iid)
+}
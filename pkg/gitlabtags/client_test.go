@@ -0,0 +1,280 @@
+package gitlabtags
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tagServer serves n tags, v1.0.0 to v1.0.<n-1>, a page at a time at api
+// (e.g. "api/v4/"), with X-Next-Page headers, X-Total-Pages as well if total
+// is set, and 404 Not Found for any other path. It counts the pages served.
+type tagServer struct {
+	n     int
+	api   string
+	total bool
+	pages int32
+}
+
+func (s *tagServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/"+s.api+"projects/g/p/repository/tags" {
+		http.NotFound(w, r)
+		return
+	}
+	atomic.AddInt32(&s.pages, 1)
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	last := (s.n + perPage - 1) / perPage
+	if page < last {
+		w.Header().Set("X-Next-Page", strconv.Itoa(page+1))
+	}
+	if s.total {
+		w.Header().Set("X-Total-Pages", strconv.Itoa(last))
+	}
+	type commit struct {
+		ID            string    `json:"id"`
+		Message       string    `json:"message"`
+		CommittedDate time.Time `json:"committed_date"`
+	}
+	tags := []map[string]interface{}{}
+	for i := (page - 1) * perPage; i < page*perPage && i < s.n; i++ {
+		tags = append(tags, map[string]interface{}{
+			"name":   fmt.Sprintf("v1.0.%d", i),
+			"commit": commit{fmt.Sprintf("%040x", i), "Release 1.0." + strconv.Itoa(i) + "\n\nBody", time.Date(2021, 1, 1, 0, 0, i, 0, time.UTC)},
+		})
+	}
+	json.NewEncoder(w).Encode(tags)
+}
+
+func TestListTagsPagination(t *testing.T) {
+	tests := []struct {
+		name        string
+		n           int
+		total       bool
+		concurrency int
+		maxTags     int
+		want        int
+		wantPages   int32
+	}{
+		{"one page", 30, false, 1, 0, 30, 1},
+		{"next page headers", 250, false, 1, 0, 250, 3},
+		{"total pages, concurrently", 250, true, 4, 0, 250, 3},
+		{"total pages, one at a time", 250, true, 1, 0, 250, 3},
+		{"max tags within first page", 250, false, 1, 50, 50, 1},
+		{"max tags across pages", 250, true, 4, 150, 150, 2},
+		{"no tags", 0, false, 1, 0, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &tagServer{n: tt.n, api: "api/v4/", total: tt.total}
+			srv := httptest.NewServer(s)
+			defer srv.Close()
+			c, err := NewClient(srv.URL, "", srv.Client())
+			if err != nil {
+				t.Fatal(err)
+			}
+			tags, _, err := c.ListTags(context.Background(), "g/p", ListOptions{MaxTags: tt.maxTags, Concurrency: tt.concurrency})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tags) != tt.want {
+				t.Fatalf("got %d tags, want %d", len(tags), tt.want)
+			}
+			for i, tag := range tags {
+				if want := fmt.Sprintf("v1.0.%d", i); tag.Name != want {
+					t.Fatalf("tag %d is %s, want %s", i, tag.Name, want)
+				}
+			}
+			if s.pages != tt.wantPages {
+				t.Errorf("fetched %d pages, want %d", s.pages, tt.wantPages)
+			}
+		})
+	}
+}
+
+func TestStreamTagsPagination(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     int
+		want      int
+		wantPages int32
+	}{
+		{"all", 0, 250, 3},
+		{"limit within first page", 20, 20, 1},
+		{"limit across pages", 120, 120, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &tagServer{n: 250, api: "api/v4/"}
+			srv := httptest.NewServer(s)
+			defer srv.Close()
+			c, err := NewClient(srv.URL, "", srv.Client())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got Tags
+			_, err = c.StreamTags(context.Background(), "g/p", ListOptions{Limit: tt.limit}, func(tags Tags) error {
+				got = append(got, tags...)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != tt.want {
+				t.Errorf("got %d tags, want %d", len(got), tt.want)
+			}
+			if s.pages != tt.wantPages {
+				t.Errorf("fetched %d pages, want %d", s.pages, tt.wantPages)
+			}
+		})
+	}
+}
+
+func TestListTagsV3Fallback(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int // status of /api/v4/version
+		wantV3  bool
+	}{
+		{"v4 missing", http.StatusNotFound, true},
+		{"v4 gone", http.StatusGone, true},
+		{"v4 present, project missing", http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tags := &tagServer{n: 3, api: "api/v3/"}
+			mux := http.NewServeMux()
+			mux.Handle("/api/v3/", tags)
+			mux.HandleFunc("/api/v4/", func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/api/v4/version" {
+					w.WriteHeader(tt.version)
+					fmt.Fprint(w, `{"version":"15.0.0"}`)
+					return
+				}
+				http.NotFound(w, r)
+			})
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+			c, err := NewClient(srv.URL, "", srv.Client())
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _, err := c.ListTags(context.Background(), "g/p", ListOptions{})
+			if !tt.wantV3 {
+				var se *StatusError
+				if !errors.As(err, &se) || se.StatusCode != http.StatusNotFound {
+					t.Fatalf("got error %v, want 404 Not Found", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 3 {
+				t.Fatalf("got %d tags, want 3", len(got))
+			}
+			commit := got[1].Commit
+			if commit.ShortID != commit.ID[:8] || commit.Title != "Release 1.0.1" || commit.CreatedAt.IsZero() {
+				t.Errorf("v3 commit not filled in: %+v", commit)
+			}
+			if c.apiPath() != "api/v3/" {
+				t.Errorf("later requests use %s, want api/v3/", c.apiPath())
+			}
+		})
+	}
+}
+
+func TestFetchTagsPagesConcurrently(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+		failPage    int // page answered with 500, or 0 for none
+	}{
+		{"one worker", 1, 0},
+		{"fewer workers than pages", 3, 0},
+		{"more workers than pages", 20, 0},
+		{"failing page", 4, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const pages = 8
+			s := &tagServer{n: pages * perPage, api: "api/v4/", total: true}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+				if page == tt.failPage {
+					http.Error(w, "boom", http.StatusInternalServerError)
+					return
+				}
+				// Later pages are answered sooner, so they arrive out of
+				// order.
+				time.Sleep(time.Duration(pages-page) * time.Millisecond)
+				s.ServeHTTP(w, r)
+			}))
+			defer srv.Close()
+			c, err := NewClient(srv.URL, "", srv.Client())
+			if err != nil {
+				t.Fatal(err)
+			}
+			tags, _, err := c.ListTags(context.Background(), "g/p", ListOptions{Concurrency: tt.concurrency})
+			if tt.failPage > 0 {
+				var se *StatusError
+				if !errors.As(err, &se) || se.StatusCode != http.StatusInternalServerError {
+					t.Fatalf("got error %v, want 500 Internal Server Error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tags) != pages*perPage {
+				t.Fatalf("got %d tags, want %d", len(tags), pages*perPage)
+			}
+			for i, tag := range tags {
+				if want := fmt.Sprintf("v1.0.%d", i); tag.Name != want {
+					t.Fatalf("tag %d is %s, want %s", i, tag.Name, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchSignaturesError(t *testing.T) {
+	const n = 20
+	failing := fmt.Sprintf("%040x", n-1)
+	s := &tagServer{n: n, api: "api/v4/"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/signature") {
+			s.ServeHTTP(w, r)
+			return
+		}
+		if strings.Contains(r.URL.Path, failing) {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		// The other requests are still running when the last one fails, and
+		// are canceled by it.
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		fmt.Fprint(w, `{"signature_type":"PGP","verification_status":"verified"}`)
+	}))
+	defer srv.Close()
+	c, err := NewClient(srv.URL, "", srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = c.ListTags(context.Background(), "g/p", ListOptions{Signatures: true, Concurrency: n})
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("got error %v, want 500 Internal Server Error", err)
+	}
+}
@@ -0,0 +1,148 @@
+package gitlabtags
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// credentialHeaders are the request headers that carry a token.
+var credentialHeaders = []string{"PRIVATE-TOKEN", "JOB-TOKEN", "Authorization"}
+
+// credentialParams are the query parameters that can carry a token.
+var credentialParams = []string{"private_token", "access_token", "job_token"}
+
+// LogTransport is an http.RoundTripper that logs each request it makes: its
+// method and URL, the response status, the position of the page in the
+// pagination headers or the page query parameter, if any, and how long it
+// took. Tokens are redacted. The zero value logs with log.Printf and makes the
+// requests with http.DefaultTransport.
+type LogTransport struct {
+	// Base makes the requests; http.DefaultTransport is used if it is nil.
+	Base http.RoundTripper
+
+	// Logger logs each request as a record with the attributes method, url,
+	// status or err, duration, and page and total_pages if there are any.
+	// If it is nil, Logf is used.
+	Logger *slog.Logger
+
+	// Logf writes a line of the log, if Logger is nil. If it is nil too,
+	// log.Printf is used.
+	Logf func(format string, args ...interface{})
+
+	// Headers also logs the headers of each request and response.
+	Headers bool
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *LogTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	u := RedactURL(req.URL)
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		if t.Logger != nil {
+			t.Logger.Error("request failed", "method", req.Method, "url", u, "err", err, "duration", elapsed)
+		} else {
+			t.logf("%s %s: %s (%s)", req.Method, u, err, elapsed)
+		}
+		if t.Headers {
+			t.logHeaders("request", "> ", req.Header)
+		}
+		return nil, err
+	}
+	page := resp.Header.Get("X-Page")
+	if page == "" {
+		page = req.URL.Query().Get("page")
+	}
+	total := resp.Header.Get("X-Total-Pages")
+	if t.Logger != nil {
+		attrs := []slog.Attr{
+			slog.String("method", req.Method),
+			slog.String("url", u),
+			slog.Int("status", resp.StatusCode),
+			slog.Duration("duration", elapsed),
+		}
+		if page != "" {
+			attrs = append(attrs, slog.String("page", page))
+			if total != "" {
+				attrs = append(attrs, slog.String("total_pages", total))
+			}
+		}
+		t.Logger.LogAttrs(context.Background(), slog.LevelInfo, "request", attrs...)
+	} else {
+		if page != "" {
+			if total != "" {
+				page += " of " + total
+			}
+			page = ", page " + page
+		}
+		t.logf("%s %s: %s (%s%s)", req.Method, u, resp.Status, elapsed, page)
+	}
+	if t.Headers {
+		t.logHeaders("request", "> ", req.Header)
+		t.logHeaders("response", "< ", resp.Header)
+	}
+	return resp, nil
+}
+
+// logHeaders logs each of header, of the request or response as kind says,
+// sorted by name and prefixed by prefix with logf, with the values of
+// credentialHeaders redacted.
+func (t *LogTransport) logHeaders(kind, prefix string, header http.Header) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v := strings.Join(header[name], ", ")
+		for _, c := range credentialHeaders {
+			if strings.EqualFold(name, c) {
+				v = "REDACTED"
+			}
+		}
+		if t.Logger != nil {
+			t.Logger.Info(kind+" header", "name", name, "value", v)
+		} else {
+			t.logf("%s%s: %s", prefix, name, v)
+		}
+	}
+}
+
+// logf writes a line of the log with Logf, or log.Printf if it is nil.
+func (t *LogTransport) logf(format string, args ...interface{}) {
+	if t.Logf == nil {
+		log.Printf(format, args...)
+		return
+	}
+	t.Logf(format, args...)
+}
+
+// RedactURL returns u as a string, with any password and the values of the
+// query parameters that can carry a token redacted.
+func RedactURL(u *url.URL) string {
+	r := *u
+	if _, ok := r.User.Password(); ok {
+		r.User = url.UserPassword(r.User.Username(), "REDACTED")
+	}
+	if r.RawQuery != "" {
+		q := r.Query()
+		for _, p := range credentialParams {
+			if q.Get(p) != "" {
+				q.Set(p, "REDACTED")
+			}
+		}
+		r.RawQuery = q.Encode()
+	}
+	return r.String()
+}
@@ -0,0 +1,188 @@
+package gitlabtags
+
+import (
+	"bufio"
+	"encoding/gob"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// tagSorter sorts tags as ListOptions ask without holding more than max of
+// them in memory: each time max tags have been added, they are sorted and
+// written to a temporary file as a run, and the runs are merged as the sorted
+// tags are read back. Tags keep the order they were added in where the sort
+// does not decide, as the stable sorts of ListTags do.
+type tagSorter struct {
+	opts ListOptions
+	max  int
+
+	buf  []sortedTag
+	runs []*os.File
+	seq  int
+}
+
+// sortedTag is a tag being sorted, numbered in the order it was added.
+type sortedTag struct {
+	Tag Tag
+	Seq int
+}
+
+// newTagSorter returns a tagSorter holding up to max tags in memory, or all of
+// them if max is not positive.
+func newTagSorter(opts ListOptions, max int) *tagSorter {
+	return &tagSorter{opts: opts, max: max}
+}
+
+// compare returns a negative number if a comes before b in the order the
+// options ask for, and a positive one if it comes after.
+func (s *tagSorter) compare(a, b *sortedTag) int {
+	c := 0
+	switch {
+	case s.opts.SortByName:
+		c = -CompareNatural(a.Tag.Name, b.Tag.Name)
+	case s.opts.SortByDate:
+		switch {
+		case a.Tag.Commit.CreatedAt.After(b.Tag.Commit.CreatedAt):
+			c = -1
+		case a.Tag.Commit.CreatedAt.Before(b.Tag.Commit.CreatedAt):
+			c = 1
+		}
+	}
+	if c == 0 && s.opts.SortSemver {
+		if c = -CompareVersions(a.Tag.Version, b.Tag.Version); c == 0 {
+			c = -CompareNatural(a.Tag.Name, b.Tag.Name)
+		}
+	}
+	if c == 0 {
+		c = a.Seq - b.Seq
+	}
+	if s.opts.Ascending {
+		c = -c
+	}
+	return c
+}
+
+// add adds tags, writing a run once max tags are held.
+func (s *tagSorter) add(tags Tags) error {
+	for _, tag := range tags {
+		s.buf = append(s.buf, sortedTag{tag, s.seq})
+		s.seq++
+		if s.max > 0 && len(s.buf) >= s.max {
+			if err := s.spill(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sortBuf sorts the tags held in memory.
+func (s *tagSorter) sortBuf() {
+	sort.Slice(s.buf, func(i, j int) bool { return s.compare(&s.buf[i], &s.buf[j]) < 0 })
+}
+
+// spill writes the tags held in memory, sorted, to a new run.
+func (s *tagSorter) spill() error {
+	s.sortBuf()
+	f, err := ioutil.TempFile("", "gitlab-list-tags-*")
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, f)
+	w := bufio.NewWriter(f)
+	enc := gob.NewEncoder(w)
+	for i := range s.buf {
+		if err := enc.Encode(&s.buf[i]); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	s.buf = s.buf[:0]
+	return nil
+}
+
+// run is a source of sorted tags being merged: either a run file or the tags
+// held in memory.
+type run struct {
+	dec  *gob.Decoder
+	buf  []sortedTag
+	head sortedTag
+	ok   bool
+}
+
+// next reads the next tag of r into its head, reporting false at the end.
+func (r *run) next() error {
+	if r.dec == nil {
+		r.ok = len(r.buf) > 0
+		if r.ok {
+			r.head, r.buf = r.buf[0], r.buf[1:]
+		}
+		return nil
+	}
+	r.head = sortedTag{}
+	err := r.dec.Decode(&r.head)
+	r.ok = err == nil
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// merge calls fn with the sorted tags, batch of them at a time, stopping
+// once limit have been passed on, if limit is positive.
+func (s *tagSorter) merge(limit, batch int, fn func(Tags) error) error {
+	s.sortBuf()
+	var runs []*run
+	for _, f := range s.runs {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		runs = append(runs, &run{dec: gob.NewDecoder(bufio.NewReader(f))})
+	}
+	runs = append(runs, &run{buf: s.buf})
+	for _, r := range runs {
+		if err := r.next(); err != nil {
+			return err
+		}
+	}
+
+	var out Tags
+	for n := 0; limit <= 0 || n < limit; n++ {
+		var min *run
+		for _, r := range runs {
+			if r.ok && (min == nil || s.compare(&r.head, &min.head) < 0) {
+				min = r
+			}
+		}
+		if min == nil {
+			break
+		}
+		out = append(out, min.head.Tag)
+		if err := min.next(); err != nil {
+			return err
+		}
+		if len(out) >= batch {
+			if err := fn(out); err != nil {
+				return err
+			}
+			out = nil
+		}
+	}
+	if len(out) > 0 {
+		return fn(out)
+	}
+	return nil
+}
+
+// close removes the runs.
+func (s *tagSorter) close() {
+	for _, f := range s.runs {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	s.runs = nil
+}
@@ -0,0 +1,119 @@
+package gitlabtags
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// sorterTags returns tags with versions, dates that are shared by several of
+// them, and names that are not versions, in no particular order.
+func sorterTags() Tags {
+	var tags Tags
+	for i := 0; i < 23; i++ {
+		name := fmt.Sprintf("v1.%d.%d", (i*7)%5, (i*11)%4)
+		if i%6 == 0 {
+			name = fmt.Sprintf("nightly-%d", i)
+		}
+		tags = append(tags, Tag{
+			Name:   name + fmt.Sprintf("+%d", i),
+			Commit: Commit{ID: fmt.Sprint(i), CreatedAt: time.Date(2024, 1, 1+(i*5)%7, 0, 0, 0, 0, time.UTC)},
+		})
+	}
+	return tags
+}
+
+func names(tags Tags) []string {
+	var n []string
+	for _, tag := range tags {
+		n = append(n, tag.Name)
+	}
+	return n
+}
+
+func TestTagSorterMerge(t *testing.T) {
+	orders := []struct {
+		name string
+		opts ListOptions
+	}{
+		{"semver", ListOptions{SortSemver: true}},
+		{"semver ascending", ListOptions{SortSemver: true, Ascending: true}},
+		{"date", ListOptions{SortByDate: true}},
+		{"date with versions", ListOptions{SortSemver: true, SortByDate: true}},
+		{"date ascending", ListOptions{SortByDate: true, Ascending: true}},
+		{"name", ListOptions{SortByName: true}},
+		{"added order ascending", ListOptions{Ascending: true}},
+	}
+	sizes := []struct {
+		max, limit, batch int
+	}{
+		{0, 0, 100},  // all in memory
+		{1, 0, 100},  // a run per tag
+		{4, 0, 3},    // several runs and batches
+		{7, 10, 4},   // a limit across runs
+		{100, 5, 2},  // a limit within memory
+		{5, 100, 50}, // a limit beyond the tags
+	}
+	for _, o := range orders {
+		for _, sz := range sizes {
+			t.Run(fmt.Sprintf("%s/max %d limit %d batch %d", o.name, sz.max, sz.limit, sz.batch), func(t *testing.T) {
+				tags := sorterTags()
+				ParseVersions(tags)
+				opts := o.opts
+				opts.Limit = sz.limit
+				want, _ := SelectTags(append(Tags(nil), tags...), opts)
+
+				s := newTagSorter(o.opts, sz.max)
+				defer s.close()
+				for i := 0; i < len(tags); i += 5 {
+					end := i + 5
+					if end > len(tags) {
+						end = len(tags)
+					}
+					if err := s.add(tags[i:end]); err != nil {
+						t.Fatal(err)
+					}
+				}
+				var got Tags
+				err := s.merge(sz.limit, sz.batch, func(batch Tags) error {
+					if len(batch) > sz.batch {
+						t.Errorf("got a batch of %d tags, want at most %d", len(batch), sz.batch)
+					}
+					got = append(got, batch...)
+					return nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(names(got), names(want)) {
+					t.Errorf("merged\n%q\nwant\n%q", names(got), names(want))
+				}
+				if len(got) > 0 && !reflect.DeepEqual(got[0], want[0]) {
+					t.Errorf("first tag read back as %+v, want %+v", got[0], want[0])
+				}
+			})
+		}
+	}
+}
+
+func TestTagSorterClose(t *testing.T) {
+	s := newTagSorter(ListOptions{SortSemver: true}, 2)
+	if err := s.add(sorterTags()); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.runs) == 0 {
+		t.Fatal("no runs were written")
+	}
+	files := make([]string, len(s.runs))
+	for i, f := range s.runs {
+		files[i] = f.Name()
+	}
+	s.close()
+	for _, f := range files {
+		if _, err := os.Stat(f); !os.IsNotExist(err) {
+			t.Errorf("run %s left behind: %v", f, err)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package gitlabtags
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Provider is implemented for each supported git host. A new host is added by
+// implementing Provider and registering a constructor for it with Register.
+type Provider interface {
+	// ListTags returns the tags of project, with opts applied as described
+	// by ListOptions, and the errors from parsing tag names as semantic
+	// versions.
+	ListTags(ctx context.Context, project string, opts ListOptions) (Tags, []error, error)
+
+	// ListReleases returns the releases of project, most recent first. Hosts
+	// without releases return ErrNotSupported.
+	ListReleases(ctx context.Context, project string) ([]Release, error)
+
+	// CompareRefs returns the commits reachable from to but not from from.
+	CompareRefs(ctx context.Context, project, from, to string) (*Comparison, error)
+}
+
+// TagStreamer is implemented by providers that can pass the tags on page by
+// page as they are retrieved, rather than returning them all at once.
+type TagStreamer interface {
+	// StreamTags is like ListTags, but calls fn with the selected tags a
+	// page at a time, in order, instead of returning them. Tags that are
+	// sorted here rather than by the host are passed on once all have been
+	// retrieved, holding at most opts.MemoryTags in memory if it is set. It
+	// returns ErrNotSupported if opts cannot be streamed, as for tags listed
+	// from releases.
+	StreamTags(ctx context.Context, project string, opts ListOptions, fn func(Tags) error) ([]error, error)
+}
+
+// Linker is implemented by providers that can link to pages in the host's web
+// UI.
+type Linker interface {
+	// TagsURL returns the URL of the page listing project's tags.
+	TagsURL(project string) string
+
+	// TagURL returns the URL of the page for tag.
+	TagURL(project, tag string) string
+
+	// CompareURL returns the URL of the page comparing from with to.
+	CompareURL(project, from, to string) string
+}
+
+// MergeRequestLinker is implemented by providers that can link to merge
+// requests in the host's web UI.
+type MergeRequestLinker interface {
+	// MergeRequestURL returns the URL of the page for the merge request
+	// with the given IID in project.
+	MergeRequestURL(project string, iid int) string
+}
+
+// IssueLinker is implemented by providers that can link to issues in the
+// host's web UI.
+type IssueLinker interface {
+	// IssueURL returns the URL of the page for the issue with the given IID
+	// in project.
+	IssueURL(project string, iid int) string
+}
+
+// MergeRequestFinder is implemented by providers that can look up merge
+// requests.
+type MergeRequestFinder interface {
+	// MergeRequest returns the merge request with the given IID in project.
+	MergeRequest(ctx context.Context, project string, iid int) (*MergeRequest, error)
+}
+
+// ChangelogGenerator is implemented by providers that can generate release
+// notes themselves.
+type ChangelogGenerator interface {
+	// GenerateChangelog returns the notes for version, covering the commits
+	// reachable from to but not from from, in the host's own markdown.
+	GenerateChangelog(ctx context.Context, project, version, from, to string) (string, error)
+}
+
+// UserFinder is implemented by providers that can look up users.
+type UserFinder interface {
+	// UserByEmail returns the user with the given email address, or nil if
+	// there is none the token can see.
+	UserByEmail(ctx context.Context, email string) (*User, error)
+}
+
+// User is a user of the git host.
+type User struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	WebURL   string `json:"web_url"`
+}
+
+// MergeRequest is a merge request.
+type MergeRequest struct {
+	IID    int    `json:"iid"`
+	Title  string `json:"title"`
+	WebURL string `json:"web_url"`
+}
+
+// ProjectFinder is implemented by providers that can look up projects by
+// their numeric ID.
+type ProjectFinder interface {
+	// Project returns the project with the given ID.
+	Project(ctx context.Context, id string) (*Project, error)
+}
+
+// GroupProjectLister is implemented by providers that can list the projects
+// in a group.
+type GroupProjectLister interface {
+	// ListGroupProjects returns the projects in group, given as its full
+	// path, and in its subgroups too if subgroups is set.
+	ListGroupProjects(ctx context.Context, group string, subgroups bool) ([]Project, error)
+}
+
+// ProjectSearcher is implemented by providers that can search for projects.
+type ProjectSearcher interface {
+	// SearchProjects returns the projects whose name or full path contains
+	// query.
+	SearchProjects(ctx context.Context, query string) ([]Project, error)
+}
+
+// Project is a project on the git host.
+type Project struct {
+	ID                int    `json:"id"`
+	PathWithNamespace string `json:"path_with_namespace"`
+	WebURL            string `json:"web_url"`
+}
+
+// Releaser is implemented by providers that can publish releases.
+type Releaser interface {
+	// CreateRelease publishes release from the existing tag release.TagName,
+	// with the name, description, and asset links given in release, and
+	// returns the release as created by the host.
+	CreateRelease(ctx context.Context, project string, release Release) (*Release, error)
+
+	// UploadAsset uploads content to project as a file called name, and
+	// returns a link to it for the Assets of a release.
+	UploadAsset(ctx context.Context, project, name string, content io.Reader) (ReleaseLink, error)
+}
+
+// TagDeleter is implemented by providers that can delete tags.
+type TagDeleter interface {
+	// DeleteTag deletes the tag called tag from project.
+	DeleteTag(ctx context.Context, project, tag string) error
+}
+
+// ProtectedTagLister is implemented by providers that can list the patterns
+// of protected tags.
+type ProtectedTagLister interface {
+	// ListProtectedTags returns project's protected tag patterns.
+	ListProtectedTags(ctx context.Context, project string) ([]ProtectedTag, error)
+}
+
+// ProtectedTag is a pattern (e.g. "v*") matching tags that only some users
+// may create.
+type ProtectedTag struct {
+	Name               string        `json:"name"`
+	CreateAccessLevels []AccessLevel `json:"create_access_levels"`
+}
+
+// AccessLevel is a role or user allowed to act on a protected ref.
+type AccessLevel struct {
+	AccessLevel            int    `json:"access_level"`
+	AccessLevelDescription string `json:"access_level_description"`
+}
+
+// Release is a release published from a tag.
+type Release struct {
+	TagName     string        `json:"tag_name"`
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	CreatedAt   time.Time     `json:"created_at"`
+	ReleasedAt  time.Time     `json:"released_at"`
+	Commit      Commit        `json:"commit"`
+	Assets      ReleaseAssets `json:"assets"`
+}
+
+// ReleaseAssets are the files attached to a release.
+type ReleaseAssets struct {
+	Links []ReleaseLink `json:"links"`
+}
+
+// ReleaseLink is a link to a file attached to a release.
+type ReleaseLink struct {
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	LinkType string `json:"link_type"`
+}
+
+// Comparison is the difference between two refs.
+type Comparison struct {
+	// Commits are the commits between the refs, oldest first.
+	Commits []Commit
+}
+
+// ErrNotSupported is returned by providers for operations their host does
+// not support.
+var ErrNotSupported = errors.New("not supported by this provider")
+
+// Config is the configuration shared by all providers.
+type Config struct {
+	// BaseURL is the URL of the host (e.g. https://gitlab.example.com/).
+	BaseURL string
+
+	// Token authenticates requests if it is not empty.
+	Token string
+
+	// JobToken indicates that Token is a GitLab CI job token rather than a
+	// personal access token.
+	JobToken bool
+
+	// OAuthToken indicates that Token is an OAuth access token rather than a
+	// personal access token.
+	OAuthToken bool
+
+	// HTTPClient makes requests; http.DefaultClient is used if it is nil.
+	HTTPClient *http.Client
+}
+
+// providers are the registered provider constructors, by name.
+var providers = map[string]func(Config) (Provider, error){}
+
+// Register makes a provider available by name to NewProvider.
+func Register(name string, newProvider func(Config) (Provider, error)) {
+	providers[name] = newProvider
+}
+
+// NewProvider returns the provider registered as name, configured by cfg.
+func NewProvider(name string, cfg Config) (Provider, error) {
+	newProvider, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %s", name)
+	}
+	return newProvider(cfg)
+}
+
+// ProviderNames returns the names of the registered providers, sorted.
+func ProviderNames() []string {
+	var names []string
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
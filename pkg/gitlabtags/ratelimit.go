@@ -0,0 +1,136 @@
+package gitlabtags
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxRateLimitWaits is the number of times RateLimitTransport waits out a 429
+// response for one request before returning it.
+const maxRateLimitWaits = 5
+
+// RateLimitTransport is an http.RoundTripper that keeps requests under a
+// GitLab instance's rate limits. It spaces requests to at most MaxRPS per
+// second, pauses when the RateLimit-Remaining header reaches zero until the
+// time in RateLimit-Reset, and waits for the time in Retry-After before
+// resending requests rejected with 429 Too Many Requests. It is safe for
+// concurrent use, so one transport can be shared to limit many requests.
+type RateLimitTransport struct {
+	// Base makes the requests; http.DefaultTransport is used if it is nil.
+	Base http.RoundTripper
+
+	// MaxRPS is the maximum requests per second; 0 means no limit.
+	MaxRPS float64
+
+	// OnWait, if it is not nil, is called with how long each request that
+	// has to wait, to stay under MaxRPS or the host's limits, is delayed.
+	OnWait func(time.Duration)
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *RateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	for waits := 0; ; waits++ {
+		if err := t.wait(req); err != nil {
+			return nil, err
+		}
+		resp, err := base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		t.update(resp)
+		if resp.StatusCode != http.StatusTooManyRequests || waits >= maxRateLimitWaits || !idempotent(req) {
+			return resp, nil
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+// wait blocks until the next request may be sent, reserving its slot.
+func (t *RateLimitTransport) wait(req *http.Request) error {
+	t.mu.Lock()
+	now := time.Now()
+	start := t.next
+	if start.Before(now) {
+		start = now
+	}
+	if t.MaxRPS > 0 {
+		t.next = start.Add(time.Duration(float64(time.Second) / t.MaxRPS))
+	} else {
+		t.next = start
+	}
+	t.mu.Unlock()
+
+	d := start.Sub(now)
+	if d <= 0 {
+		return nil
+	}
+	if t.OnWait != nil {
+		t.OnWait(d)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-req.Context().Done():
+		return req.Context().Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// update delays further requests as the rate limit headers of resp require.
+func (t *RateLimitTransport) update(resp *http.Response) {
+	var until time.Time
+	if resp.StatusCode == http.StatusTooManyRequests {
+		until = retryAfter(resp.Header)
+	}
+	if until.IsZero() && (resp.StatusCode == http.StatusTooManyRequests || resp.Header.Get("RateLimit-Remaining") == "0") {
+		if reset, err := strconv.ParseInt(resp.Header.Get("RateLimit-Reset"), 10, 64); err == nil {
+			until = time.Unix(reset, 0)
+		} else if resp.StatusCode == http.StatusTooManyRequests {
+			until = time.Now().Add(time.Second)
+		}
+	}
+	if until.IsZero() {
+		return
+	}
+	t.mu.Lock()
+	if until.After(t.next) {
+		t.next = until
+	}
+	t.mu.Unlock()
+}
+
+// retryAfter returns the time given by the Retry-After header, in seconds or
+// as an HTTP date, or the zero time if there is none.
+func retryAfter(h http.Header) time.Time {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return time.Time{}
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Now().Add(time.Duration(secs) * time.Second)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,123 @@
+package gitlabtags
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimitTransportRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		limited      int // 429 responses before one succeeds
+		wantAttempts int
+		wantStatus   int
+	}{
+		{"not limited", "GET", 0, 1, 200},
+		{"limited once", "GET", 1, 2, 200},
+		{"limited too often", "GET", 10, maxRateLimitWaits + 1, 429},
+		{"post not resent", "POST", 1, 1, 429},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			rt := &RateLimitTransport{
+				Base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+					attempts++
+					if attempts <= tt.limited {
+						return response(req, http.StatusTooManyRequests, http.Header{"Retry-After": {"0"}}, ""), nil
+					}
+					return response(req, 200, nil, ""), nil
+				}),
+			}
+			req, _ := http.NewRequest(tt.method, "https://gitlab.example.com/", nil)
+			resp, err := rt.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("got status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("made %d attempts, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRateLimitTransportMaxRPS(t *testing.T) {
+	var waits []time.Duration
+	rt := &RateLimitTransport{
+		Base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return response(req, 200, nil, ""), nil
+		}),
+		MaxRPS: 100,
+		OnWait: func(d time.Duration) { waits = append(waits, d) },
+	}
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		req, _ := http.NewRequest("GET", "https://gitlab.example.com/", nil)
+		if _, err := rt.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 25*time.Millisecond {
+		t.Errorf("4 requests at 100 per second took %v, want about 30ms", elapsed)
+	}
+	if len(waits) != 3 {
+		t.Errorf("waited %d times, want 3", len(waits))
+	}
+}
+
+func TestRateLimitTransportUpdate(t *testing.T) {
+	now := time.Now()
+	reset := strconv.FormatInt(now.Add(time.Minute).Unix(), 10)
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+		want   time.Duration // the least delay of the next request, or 0 for none
+	}{
+		{"no headers", 200, nil, 0},
+		{"remaining", 200, http.Header{"Ratelimit-Remaining": {"10"}, "Ratelimit-Reset": {reset}}, 0},
+		{"exhausted", 200, http.Header{"Ratelimit-Remaining": {"0"}, "Ratelimit-Reset": {reset}}, 50 * time.Second},
+		{"retry after seconds", 429, http.Header{"Retry-After": {"30"}}, 25 * time.Second},
+		{"retry after date", 429, http.Header{"Retry-After": {now.Add(time.Minute).UTC().Format(http.TimeFormat)}}, 50 * time.Second},
+		{"429 with reset", 429, http.Header{"Ratelimit-Reset": {reset}}, 50 * time.Second},
+		{"429 without headers", 429, nil, 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &RateLimitTransport{}
+			rt.update(response(nil, tt.status, tt.header, ""))
+			delay := time.Until(rt.next)
+			if tt.want == 0 && delay > 0 {
+				t.Errorf("next request delayed by %v, want no delay", delay)
+			}
+			if tt.want > 0 && delay < tt.want {
+				t.Errorf("next request delayed by %v, want at least %v", delay, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	date := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Time // zero, or the time to within a second
+	}{
+		{"", time.Time{}},
+		{"soon", time.Time{}},
+		{"120", time.Now().Add(2 * time.Minute)},
+		{date.Format(http.TimeFormat), date},
+	}
+	for _, tt := range tests {
+		got := retryAfter(http.Header{"Retry-After": {tt.value}})
+		if tt.want.IsZero() != got.IsZero() || got.Sub(tt.want) > time.Second || tt.want.Sub(got) > time.Second {
+			t.Errorf("retryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package gitlabtags
+
+import (
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryTransport is an http.RoundTripper that retries idempotent requests
+// failing with a network error or a 5xx response, waiting with exponential
+// backoff between attempts.
+type RetryTransport struct {
+	// Base makes the requests; http.DefaultTransport is used if it is nil.
+	Base http.RoundTripper
+
+	// Retries is the number of times a request is retried after the first
+	// attempt.
+	Retries int
+
+	// Backoff is the wait before the first retry. It doubles after each
+	// attempt, up to MaxBackoff if that is not zero.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Jitter is the fraction, from 0 to 1, of each wait that is randomized
+	// so that many clients do not retry in lockstep.
+	Jitter float64
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if !idempotent(req) {
+		return base.RoundTrip(req)
+	}
+
+	wait := t.Backoff
+	for attempt := 0; ; attempt++ {
+		resp, err := base.RoundTrip(req)
+		if attempt >= t.Retries || !retryable(resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(t.jittered(wait))
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		wait *= 2
+		if t.MaxBackoff > 0 && wait > t.MaxBackoff {
+			wait = t.MaxBackoff
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+// jittered randomizes the Jitter fraction of d.
+func (t *RetryTransport) jittered(d time.Duration) time.Duration {
+	if t.Jitter <= 0 || d <= 0 {
+		return d
+	}
+	j := t.Jitter
+	if j > 1 {
+		j = 1
+	}
+	fixed := time.Duration(float64(d) * (1 - j))
+	return fixed + time.Duration(rand.Int63n(int64(float64(d)*j)+1))
+}
+
+// idempotent reports whether req can safely be sent more than once.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS":
+		return req.Body == nil || req.GetBody != nil
+	}
+	return false
+}
+
+// retryable reports whether a request that returned resp and err may succeed
+// if tried again.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode >= 500
+}
@@ -0,0 +1,147 @@
+package gitlabtags
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTripFunc is an http.RoundTripper calling itself, standing in for the
+// network under the transports.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// response returns a response to req with status, header, and body.
+func response(req *http.Request, status int, header http.Header, body string) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		StatusCode: status,
+		Status:     strconv.Itoa(status) + " " + http.StatusText(status),
+		Header:     header,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}
+}
+
+var errNetwork = errors.New("connection reset")
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		retries      int
+		failures     int   // attempts failing before one succeeds
+		failWith     error // the failure, or a 503 response if nil
+		wantAttempts int
+		wantStatus   int
+		wantErr      error
+	}{
+		{"success", "GET", 3, 0, nil, 1, 200, nil},
+		{"server error then success", "GET", 3, 2, nil, 3, 200, nil},
+		{"network error then success", "GET", 3, 1, errNetwork, 2, 200, nil},
+		{"retries exhausted", "GET", 2, 5, nil, 3, 503, nil},
+		{"network error exhausted", "GET", 1, 5, errNetwork, 2, 0, errNetwork},
+		{"no retries", "GET", 0, 1, nil, 1, 503, nil},
+		{"post not retried", "POST", 3, 1, nil, 1, 503, nil},
+		{"head retried", "HEAD", 3, 1, nil, 2, 200, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			rt := &RetryTransport{
+				Base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+					attempts++
+					if attempts <= tt.failures {
+						if tt.failWith != nil {
+							return nil, tt.failWith
+						}
+						return response(req, 503, nil, "unavailable"), nil
+					}
+					return response(req, 200, nil, "ok"), nil
+				}),
+				Retries: tt.retries,
+				Backoff: time.Millisecond,
+				Jitter:  0.5,
+			}
+			req, _ := http.NewRequest(tt.method, "https://gitlab.example.com/api/v4/version", nil)
+			resp, err := rt.RoundTrip(req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && resp.StatusCode != tt.wantStatus {
+				t.Errorf("got status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("made %d attempts, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryTransportCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	rt := &RetryTransport{
+		Base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			cancel()
+			return response(req, 503, nil, ""), nil
+		}),
+		Retries: 3,
+		Backoff: time.Hour,
+	}
+	req, _ := http.NewRequestWithContext(ctx, "GET", "https://gitlab.example.com/", nil)
+	if _, err := rt.RoundTrip(req); !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want context.Canceled", err)
+	}
+}
+
+func TestRetryTransportResendsBody(t *testing.T) {
+	var bodies []string
+	rt := &RetryTransport{
+		Base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			b, _ := ioutil.ReadAll(req.Body)
+			bodies = append(bodies, string(b))
+			if len(bodies) == 1 {
+				return response(req, 502, nil, ""), nil
+			}
+			return response(req, 200, nil, ""), nil
+		}),
+		Retries: 1,
+	}
+	req, _ := http.NewRequest("GET", "https://gitlab.example.com/", strings.NewReader("query"))
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 2 || bodies[1] != "query" {
+		t.Errorf("got bodies %q, want the body sent twice", bodies)
+	}
+}
+
+func TestJittered(t *testing.T) {
+	tests := []struct {
+		jitter   float64
+		min, max time.Duration
+	}{
+		{0, time.Second, time.Second},
+		{0.5, 500 * time.Millisecond, time.Second},
+		{1, 0, time.Second},
+		{2, 0, time.Second},
+	}
+	for _, tt := range tests {
+		rt := &RetryTransport{Jitter: tt.jitter}
+		for i := 0; i < 100; i++ {
+			if d := rt.jittered(time.Second); d < tt.min || d > tt.max {
+				t.Fatalf("jitter %v: got %v, want between %v and %v", tt.jitter, d, tt.min, tt.max)
+			}
+		}
+	}
+}
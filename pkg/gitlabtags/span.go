@@ -0,0 +1,27 @@
+package gitlabtags
+
+import "context"
+
+// SpanFunc starts a span named name, with the attributes given as key and
+// value pairs in attrs, as a child of the span in ctx, if there is one. It
+// returns a context holding the new span, and a function ending it with the
+// error the operation failed with, or nil.
+type SpanFunc func(ctx context.Context, name string, attrs ...string) (context.Context, func(error))
+
+type spanKey struct{}
+
+// WithSpans returns a copy of ctx with which the providers trace their
+// operations, such as listing tags and retrieving each page of them, with
+// start, for tracing systems such as OpenTelemetry.
+func WithSpans(ctx context.Context, start SpanFunc) context.Context {
+	return context.WithValue(ctx, spanKey{}, start)
+}
+
+// startSpan starts a span with the SpanFunc of ctx, if it has one.
+func startSpan(ctx context.Context, name string, attrs ...string) (context.Context, func(error)) {
+	start, ok := ctx.Value(spanKey{}).(SpanFunc)
+	if !ok {
+		return ctx, func(error) {}
+	}
+	return start(ctx, name, attrs...)
+}
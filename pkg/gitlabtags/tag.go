@@ -0,0 +1,550 @@
+package gitlabtags
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blang/semver"
+)
+
+// Tag is the individual tag from gitlab, with addition of Version. Message
+// is the tag's message, or for a tag without one, such as a lightweight tag
+// whose release notes were written in the UI, its release's description.
+type Tag struct {
+	Version semver.Version `json:"-"`
+	Name    string         `json:"name"`
+	Message string         `json:"message"`
+	Commit  Commit         `json:"commit"`
+
+	// Target is the ID of the object the tag points at: the tag object of
+	// an annotated tag, or the commit of a lightweight one, if the host
+	// reports it.
+	Target string `json:"target"`
+
+	// Tagger is the name of who created an annotated tag, and CreatedAt when
+	// they did, if the host reports them. GitLab reports only CreatedAt.
+	Tagger    string    `json:"tagger"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Release is the release published from the tag, if there is one. It is
+	// only complete for tags listed with ListOptions.Releases; otherwise
+	// GitLab gives just its description.
+	Release *Release `json:"release"`
+
+	// Protected records whether the tag matches one of the project's
+	// protected tag patterns.
+	Protected bool `json:"protected"`
+
+	// Signature is the signature of the tag's commit. It is only set for
+	// tags listed with ListOptions.Signatures.
+	Signature *Signature `json:"-"`
+
+	// Parsed records whether Version was successfully parsed from Name.
+	Parsed bool `json:"-"`
+
+	// Aliases are the names of the other tags pointing at the same commit,
+	// for tags collapsed by DedupeCommits.
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// Annotated reports whether t is an annotated tag, rather than a lightweight
+// one: whether it points at a tag object of its own, or, where the host does
+// not say what it points at, whether it has a message, tagger, or date.
+func (t Tag) Annotated() bool {
+	if t.Target != "" && t.Commit.ID != "" {
+		return t.Target != t.Commit.ID
+	}
+	return t.Message != "" || t.Tagger != "" || !t.CreatedAt.IsZero()
+}
+
+// Commit is a commit, such as the one a gitlab tag points at.
+type Commit struct {
+	ID             string    `json:"id"`
+	ShortID        string    `json:"short_id"`
+	Title          string    `json:"title"`
+	Message        string    `json:"message"`
+	AuthorName     string    `json:"author_name"`
+	AuthorEmail    string    `json:"author_email"`
+	AuthoredDate   time.Time `json:"authored_date"`
+	CommitterName  string    `json:"committer_name"`
+	CommitterEmail string    `json:"committer_email"`
+	CommittedDate  time.Time `json:"committed_date"`
+	CreatedAt      time.Time `json:"created_at"`
+	WebURL         string    `json:"web_url"`
+}
+
+// SignatureUnsigned is the Status of the Signature of an unsigned commit.
+const SignatureUnsigned = "unsigned"
+
+// Signature is the signature of a commit.
+type Signature struct {
+	// Type is the kind of signature: PGP, X509, or SSH.
+	Type string
+
+	// Status is the verification status reported by the host, such as
+	// "verified" or "unverified", or SignatureUnsigned.
+	Status string
+}
+
+// Verified reports whether the commit is signed and the signature was
+// verified.
+func (s *Signature) Verified() bool {
+	return s != nil && (s.Status == "verified" || s.Status == "verified_system")
+}
+
+// Tags is the array of gitlab tags.
+type Tags []Tag
+
+func (a Tags) Len() int      { return len(a) }
+func (a Tags) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+
+// This is a reverse sort - most recent first, hence > instead of <. Tags with
+// the same version, such as those whose names could not be parsed, are
+// ordered by name with CompareNatural.
+func (a Tags) Less(i, j int) bool {
+	if c := CompareVersions(a[i].Version, a[j].Version); c != 0 {
+		return c > 0
+	}
+	return CompareNatural(a[i].Name, a[j].Name) > 0
+}
+
+// CompareNatural returns -1, 0, or 1 as the name a is less than, equal to, or
+// greater than b, comparing the runs of digits in them as numbers, so that v9
+// is less than v10 and release-3.7 than release-3.10. Numbers equal but for
+// leading zeros, as in 1.02 and 1.2, are then ordered as strings.
+func CompareNatural(a, b string) int {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if !isDigit(a[i]) || !isDigit(b[j]) {
+			if a[i] != b[j] {
+				if a[i] < b[j] {
+					return -1
+				}
+				return 1
+			}
+			i++
+			j++
+			continue
+		}
+		si, sj := i, j
+		for i < len(a) && isDigit(a[i]) {
+			i++
+		}
+		for j < len(b) && isDigit(b[j]) {
+			j++
+		}
+		x, y := strings.TrimLeft(a[si:i], "0"), strings.TrimLeft(b[sj:j], "0")
+		switch {
+		case len(x) != len(y):
+			if len(x) < len(y) {
+				return -1
+			}
+			return 1
+		case x != y:
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(a)-i < len(b)-j:
+		return -1
+	case len(a)-i > len(b)-j:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+// CompareVersions returns -1, 0, or 1 as a is less than, equal to, or greater
+// than b. Versions that semantic versioning ranks equally because they differ
+// only in build metadata (e.g. 1.2.3+build.45 and 1.2.3+build.46) are ordered
+// by their build metadata, compared like pre-release identifiers, so that
+// such builds sort and filter predictably. A version without build metadata
+// is less than one with it.
+func CompareVersions(a, b semver.Version) int {
+	if c := a.Compare(b); c != 0 {
+		return c
+	}
+	for i := 0; i < len(a.Build) && i < len(b.Build); i++ {
+		x, y := a.Build[i], b.Build[i]
+		xn, xerr := strconv.ParseUint(x, 10, 64)
+		yn, yerr := strconv.ParseUint(y, 10, 64)
+		switch {
+		case xerr == nil && yerr == nil && xn != yn:
+			if xn < yn {
+				return -1
+			}
+			return 1
+		case xerr == nil && yerr != nil:
+			return -1
+		case xerr != nil && yerr == nil:
+			return 1
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	switch {
+	case len(a.Build) < len(b.Build):
+		return -1
+	case len(a.Build) > len(b.Build):
+		return 1
+	}
+	return 0
+}
+
+// ParseError is returned for a tag whose name is not a semantic version.
+type ParseError struct {
+	Tag string
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("error parsing tag %s: %s", e.Tag, e.Err)
+}
+
+// DefaultStripPrefixes are the prefixes removed from the start of tag names
+// before they are parsed as versions, unless others are given.
+var DefaultStripPrefixes = []string{"v"}
+
+// ParseVersions sets Version and Parsed on each tag whose name, with a leading
+// "v" removed, is a semantic version. A ParseError is returned for each tag
+// that is not; those tags keep the zero Version.
+func ParseVersions(tags Tags) []error {
+	return ParsePrefixedVersions(tags, "", DefaultStripPrefixes)
+}
+
+// ParsePrefixedVersions is like ParseVersions, but first removes prefix from
+// the start of each tag name, for tags such as "servicefoo/v1.2.3" naming the
+// versions of one component of a monorepo, and then the longest of strip
+// that the rest starts with, such as "v" or "release-". Names keep their
+// prefixes.
+func ParsePrefixedVersions(tags Tags, prefix string, strip []string) []error {
+	return ParseVersionsWith(tags, prefix, strip, semver.Make)
+}
+
+// VersionParser parses the version in a tag name, once its prefixes are
+// removed.
+type VersionParser func(name string) (semver.Version, error)
+
+// ParseVersionsWith is like ParsePrefixedVersions, but parses the versions
+// with parse, such as CoerceVersion, rather than as strict semantic versions.
+func ParseVersionsWith(tags Tags, prefix string, strip []string, parse VersionParser) []error {
+	var errs []error
+	for i := range tags {
+		n := stripPrefix(strings.TrimPrefix(tags[i].Name, prefix), strip)
+		vers, err := parse(n)
+		if err != nil {
+			errs = append(errs, &ParseError{Tag: tags[i].Name, Err: err})
+			continue
+		}
+		tags[i].Version = vers
+		tags[i].Parsed = true
+	}
+	return errs
+}
+
+// coerceRE matches the numbers at the start of a version that is not quite a
+// semantic version, such as 1.2, 1, or 1.2.3.4, and what follows them.
+var coerceRE = regexp.MustCompile(`^(\d+)(?:\.(\d+))?(?:\.(\d+))?((?:\.\d+)*)(.*)$`)
+
+// CoerceVersion parses s as a semantic version if it is one, and otherwise
+// coerces versions that are almost semantic into one: missing minor and patch
+// numbers are taken as 0, so that 1.2 is 1.2.0, leading zeros are dropped,
+// and numbers beyond the patch number, as in 1.2.3.4, become build metadata,
+// which CompareVersions orders numerically. A pre-release or build metadata
+// may follow the numbers, as in 1.2-rc.1.
+func CoerceVersion(s string) (semver.Version, error) {
+	v, err := semver.Make(s)
+	if err == nil {
+		return v, nil
+	}
+	m := coerceRE.FindStringSubmatch(s)
+	if m == nil {
+		return semver.Version{}, err
+	}
+	return makeVersion(m[1:4], m[4], m[5])
+}
+
+// makeVersion returns the version with the major, minor, and patch numbers in
+// nums, the empty ones taken as 0, the further numbers in extra, such as
+// ".4", as build metadata, and the pre-release or build metadata in rest,
+// such as "-rc.1".
+func makeVersion(nums []string, extra, rest string) (semver.Version, error) {
+	var v semver.Version
+	for i, n := range []*uint64{&v.Major, &v.Minor, &v.Patch} {
+		if nums[i] == "" {
+			continue
+		}
+		var err error
+		if *n, err = strconv.ParseUint(nums[i], 10, 64); err != nil {
+			return semver.Version{}, err
+		}
+	}
+	if extra = strings.TrimPrefix(extra, "."); extra != "" {
+		v.Build = strings.Split(extra, ".")
+	}
+	if rest != "" {
+		r, err := semver.Make("0.0.0" + rest)
+		if err != nil {
+			return semver.Version{}, err
+		}
+		v.Pre, v.Build = r.Pre, append(v.Build, r.Build...)
+	}
+	return v, nil
+}
+
+// calVerRE matches a calendar version: a four or two digit year, a month,
+// optionally a day or other number, any further numbers, and a pre-release
+// or build metadata.
+var calVerRE = regexp.MustCompile(`^(\d{4}|\d{2})\.(\d{1,2})(?:\.(\d+))?((?:\.\d+)*)([-+].*)?$`)
+
+// ParseCalVer parses s as a calendar version, such as 2024.01.15 in the
+// YYYY.MM.DD scheme or 24.03.1 in the YY.MM.MICRO scheme, into a version
+// that orders as the dates do: the year is the major number, with two digit
+// years taken to be in the 2000s, the month the minor number, and the day
+// or micro number, if any, the patch number. A modifier, as in
+// 2024.01.15-beta.1, is a pre-release.
+func ParseCalVer(s string) (semver.Version, error) {
+	m := calVerRE.FindStringSubmatch(s)
+	if m == nil {
+		return semver.Version{}, fmt.Errorf("not a calendar version such as YYYY.MM.DD or YY.MM.MICRO")
+	}
+	if month, _ := strconv.Atoi(m[2]); month < 1 || month > 12 {
+		return semver.Version{}, fmt.Errorf("month %s is not from 1 to 12", m[2])
+	}
+	v, err := makeVersion(m[1:4], m[4], m[5])
+	if err != nil {
+		return semver.Version{}, err
+	}
+	if len(m[1]) == 2 {
+		v.Major += 2000
+	}
+	return v, nil
+}
+
+// VersionRegex returns a parser of the versions in tag names matched by re,
+// made of the numbers its capture groups match, in order: the first three are
+// the major, minor, and patch numbers, and further ones build metadata
+// compared as numbers. Groups that match nothing count as 0. re should be
+// anchored, so that it matches whole names.
+func VersionRegex(re *regexp.Regexp) VersionParser {
+	return func(name string) (semver.Version, error) {
+		m := re.FindStringSubmatch(name)
+		if m == nil {
+			return semver.Version{}, fmt.Errorf("does not match %s", re)
+		}
+		nums := make([]string, 3, len(m)+2)
+		var extra []string
+		for i, g := range m[1:] {
+			if g == "" {
+				g = "0"
+			}
+			n, err := strconv.ParseUint(g, 10, 64)
+			if err != nil {
+				return semver.Version{}, fmt.Errorf("group %d of %s, %q, is not a number", i+1, re, g)
+			}
+			if i < 3 {
+				nums[i] = g
+			} else {
+				extra = append(extra, strconv.FormatUint(n, 10))
+			}
+		}
+		return makeVersion(nums, strings.Join(extra, "."), "")
+	}
+}
+
+// stripPrefix removes the longest of prefixes that name starts with.
+func stripPrefix(name string, prefixes []string) string {
+	longest := ""
+	for _, p := range prefixes {
+		if strings.HasPrefix(name, p) && len(p) > len(longest) {
+			longest = p
+		}
+	}
+	return name[len(longest):]
+}
+
+// Sort sorts tags by Version, most recent first.
+func Sort(tags Tags) {
+	sort.Sort(tags)
+}
+
+// DedupeCommits collapses the tags pointing at the same commit, such as 1.2.0
+// and latest, into one, keeping the one with the greatest version, or else the
+// first, in its place and setting its Aliases to the names of the others in
+// order. Tags whose commit is not known are kept as they are.
+func DedupeCommits(tags Tags) Tags {
+	kept := map[string]int{}
+	for i, tag := range tags {
+		id := tag.Commit.ID
+		if id == "" {
+			continue
+		}
+		j, ok := kept[id]
+		if !ok || tag.Parsed && (!tags[j].Parsed || CompareVersions(tag.Version, tags[j].Version) > 0) {
+			kept[id] = i
+		}
+	}
+	aliases := map[string][]string{}
+	for i, tag := range tags {
+		if j, ok := kept[tag.Commit.ID]; ok && i != j {
+			aliases[tag.Commit.ID] = append(aliases[tag.Commit.ID], tag.Name)
+		}
+	}
+	var out Tags
+	for i, tag := range tags {
+		j, ok := kept[tag.Commit.ID]
+		if ok && i != j {
+			continue
+		}
+		if ok {
+			tag.Aliases = aliases[tag.Commit.ID]
+		}
+		out = append(out, tag)
+	}
+	return out
+}
+
+// SortByName sorts tags by name with CompareNatural, the greatest first, so
+// that v10 comes before v9.
+func SortByName(tags Tags) {
+	sort.Slice(tags, func(i, j int) bool { return CompareNatural(tags[i].Name, tags[j].Name) > 0 })
+}
+
+// SortByDate sorts tags by the date of their commit, most recent first.
+// Tags with the same date keep their order.
+func SortByDate(tags Tags) {
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].Commit.CreatedAt.After(tags[j].Commit.CreatedAt)
+	})
+}
+
+// Reverse reverses the order of tags, e.g. to put the oldest first.
+func Reverse(tags Tags) {
+	for i, j := 0, len(tags)-1; i < j; i, j = i+1, j-1 {
+		tags[i], tags[j] = tags[j], tags[i]
+	}
+}
+
+// Since returns the tags whose Version is greater than or equal to v.
+func Since(tags Tags, v semver.Version) Tags {
+	var selected Tags
+	for _, tag := range tags {
+		if CompareVersions(tag.Version, v) >= 0 {
+			selected = append(selected, tag)
+		}
+	}
+	return selected
+}
+
+// Until returns the tags whose Version is less than or equal to v.
+func Until(tags Tags, v semver.Version) Tags {
+	var selected Tags
+	for _, tag := range tags {
+		if CompareVersions(tag.Version, v) <= 0 {
+			selected = append(selected, tag)
+		}
+	}
+	return selected
+}
+
+// HasPrefix returns the tags whose names start with prefix.
+func HasPrefix(tags Tags, prefix string) Tags {
+	var selected Tags
+	for _, tag := range tags {
+		if strings.HasPrefix(tag.Name, prefix) {
+			selected = append(selected, tag)
+		}
+	}
+	return selected
+}
+
+// Search returns the tags whose names contain s, or, as GitLab's tag search
+// does, start with s after a leading "^" or end with it before a trailing
+// "$".
+func Search(tags Tags, s string) Tags {
+	var selected Tags
+	for _, tag := range tags {
+		if searchMatches(tag.Name, s) {
+			selected = append(selected, tag)
+		}
+	}
+	return selected
+}
+
+// searchMatches reports whether name matches the search s.
+func searchMatches(name, s string) bool {
+	switch {
+	case strings.HasPrefix(s, "^"):
+		return strings.HasPrefix(name, s[1:])
+	case strings.HasSuffix(s, "$"):
+		return strings.HasSuffix(name, s[:len(s)-1])
+	}
+	return strings.Contains(name, s)
+}
+
+// Stable returns the tags whose Version has no pre-release part.
+func Stable(tags Tags) Tags {
+	var selected Tags
+	for _, tag := range tags {
+		if len(tag.Version.Pre) == 0 {
+			selected = append(selected, tag)
+		}
+	}
+	return selected
+}
+
+// Match returns the tags whose names re matches.
+func Match(tags Tags, re *regexp.Regexp) Tags {
+	var selected Tags
+	for _, tag := range tags {
+		if re.MatchString(tag.Name) {
+			selected = append(selected, tag)
+		}
+	}
+	return selected
+}
+
+// AnnotatedOnly returns the annotated tags, leaving out the lightweight ones.
+func AnnotatedOnly(tags Tags) Tags {
+	var selected Tags
+	for _, tag := range tags {
+		if tag.Annotated() {
+			selected = append(selected, tag)
+		}
+	}
+	return selected
+}
+
+// Exclude returns the tags whose names none of res match.
+func Exclude(tags Tags, res ...*regexp.Regexp) Tags {
+	var selected Tags
+outer:
+	for _, tag := range tags {
+		for _, re := range res {
+			if re.MatchString(tag.Name) {
+				continue outer
+			}
+		}
+		selected = append(selected, tag)
+	}
+	return selected
+}
+
+// FirstLine returns s up to, but not including, the first newline, as for the
+// title of a commit or tag message.
+func FirstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimRight(s, "\r")
+}
@@ -0,0 +1,272 @@
+package gitlabtags
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/blang/semver"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.2.3", "1.2.4", -1},
+		{"2.0.0", "1.9.9", 1},
+		{"1.0.0-rc.1", "1.0.0", -1},
+		{"1.0.0-rc.2", "1.0.0-rc.10", -1},
+		{"1.2.3", "1.2.3+build.1", -1},
+		{"1.2.3+build.45", "1.2.3+build.46", -1},
+		{"1.2.3+build.9", "1.2.3+build.10", -1},
+		{"1.2.3+45", "1.2.3+abc", -1},
+		{"1.2.3+abc", "1.2.3+abd", -1},
+		{"1.2.3+1", "1.2.3+1.1", -1},
+		{"1.2.3+build.2", "1.2.3+build.2", 0},
+		{"1.2.4", "1.2.3+build.99", 1},
+	}
+	for _, tt := range tests {
+		a, b := semver.MustParse(tt.a), semver.MustParse(tt.b)
+		if got := CompareVersions(a, b); got != tt.want {
+			t.Errorf("CompareVersions(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := CompareVersions(b, a); got != -tt.want {
+			t.Errorf("CompareVersions(%s, %s) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestCoerceVersion(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"1.2.3", "1.2.3", false},
+		{"1.2.3-rc.1+b", "1.2.3-rc.1+b", false},
+		{"1.2", "1.2.0", false},
+		{"1", "1.0.0", false},
+		{"1.02.3", "1.2.3", false},
+		{"1.2.3.4", "1.2.3+4", false},
+		{"1.2.3.4.5", "1.2.3+4.5", false},
+		{"1.2-rc.1", "1.2.0-rc.1", false},
+		{"1.2.3.4+ci", "1.2.3+4.ci", false},
+		{"latest", "", true},
+		{"1.2-", "", true},
+	}
+	for _, tt := range tests {
+		got, err := CoerceVersion(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CoerceVersion(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got.String() != tt.want {
+			t.Errorf("CoerceVersion(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseCalVer(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"2024.01.15", "2024.1.15", false},
+		{"2024.1", "2024.1.0", false},
+		{"24.03.1", "2024.3.1", false},
+		{"2024.12.01.2", "2024.12.1+2", false},
+		{"2024.01.15-beta.1", "2024.1.15-beta.1", false},
+		{"2024.01.15+ci.7", "2024.1.15+ci.7", false},
+		{"2024.13.01", "", true},
+		{"2024.00.01", "", true},
+		{"202.01.01", "", true},
+		{"1.2.3", "", true},
+		{"nightly", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCalVer(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCalVer(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got.String() != tt.want {
+			t.Errorf("ParseCalVer(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	// Two and four digit years order together.
+	a, _ := ParseCalVer("24.03.1")
+	b, _ := ParseCalVer("2023.12.31")
+	if CompareVersions(a, b) <= 0 {
+		t.Errorf("24.03.1 does not order after 2023.12.31")
+	}
+}
+
+func TestVersionRegex(t *testing.T) {
+	tests := []struct {
+		re      string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{`^release-(\d+)\.(\d+)$`, "release-3.10", "3.10.0", false},
+		{`^build-(\d+)$`, "build-12", "12.0.0", false},
+		{`^(\d+)\.(\d+)\.(\d+)\.(\d+)$`, "1.2.3.4", "1.2.3+4", false},
+		{`^(\d+)\.(\d+)(?:\.(\d+))?$`, "1.2", "1.2.0", false},
+		{`^r(\d+)-(\d+)-(\d+)-(\d+)-(\d+)$`, "r1-2-3-04-5", "1.2.3+4.5", false},
+		{`^release-(\d+)\.(\d+)$`, "release-3", "", true},
+		{`^v([a-z]+)$`, "vbeta", "", true},
+	}
+	for _, tt := range tests {
+		got, err := VersionRegex(regexp.MustCompile(tt.re))(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("VersionRegex(%s)(%q) error = %v, want error %v", tt.re, tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got.String() != tt.want {
+			t.Errorf("VersionRegex(%s)(%q) = %s, want %s", tt.re, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCompareNatural(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v9", "v10", -1},
+		{"v10", "v10", 0},
+		{"release-3.7", "release-3.10", -1},
+		{"build-9", "build-12", -1},
+		{"1.02", "1.2", -1},
+		{"a", "b", -1},
+		{"v1", "v1.0", -1},
+		{"v1", "w", -1},
+		{"", "a", -1},
+		{"007", "7", -1},
+		{"x99999999999999999999", "x100000000000000000000", -1},
+	}
+	for _, tt := range tests {
+		if got := CompareNatural(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareNatural(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := CompareNatural(tt.b, tt.a); got != -tt.want {
+			t.Errorf("CompareNatural(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestSortByName(t *testing.T) {
+	tags := Tags{{Name: "v9"}, {Name: "v10"}, {Name: "build-12"}, {Name: "v1.10"}, {Name: "build-9"}, {Name: "v1.9"}}
+	SortByName(tags)
+	var got []string
+	for _, tag := range tags {
+		got = append(got, tag.Name)
+	}
+	want := []string{"v10", "v9", "v1.10", "v1.9", "build-12", "build-9"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SortByName = %q, want %q", got, want)
+	}
+}
+
+func TestSortUnparsedByName(t *testing.T) {
+	tags := Tags{{Name: "nightly-9"}, {Name: "v1.0.0"}, {Name: "nightly-10"}, {Name: "v2.0.0"}}
+	ParseVersions(tags)
+	Sort(tags)
+	var got []string
+	for _, tag := range tags {
+		got = append(got, tag.Name)
+	}
+	want := []string{"v2.0.0", "v1.0.0", "nightly-10", "nightly-9"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Sort = %q, want %q", got, want)
+	}
+}
+
+func TestDedupeCommits(t *testing.T) {
+	tag := func(name, commit string) Tag {
+		return Tag{Name: name, Commit: Commit{ID: commit}}
+	}
+	tests := []struct {
+		name        string
+		tags        Tags
+		want        []string
+		wantAliases [][]string
+	}{
+		{
+			"distinct commits",
+			Tags{tag("v1.1.0", "b"), tag("v1.0.0", "a")},
+			[]string{"v1.1.0", "v1.0.0"},
+			[][]string{nil, nil},
+		},
+		{
+			"greatest version kept",
+			Tags{tag("latest", "b"), tag("v1.1.0", "b"), tag("v1.1.0-rc.1", "b"), tag("v1.0.0", "a")},
+			[]string{"v1.1.0", "v1.0.0"},
+			[][]string{{"latest", "v1.1.0-rc.1"}, nil},
+		},
+		{
+			"first kept without versions",
+			Tags{tag("stable", "a"), tag("latest", "a")},
+			[]string{"stable"},
+			[][]string{{"latest"}},
+		},
+		{
+			"unknown commits kept",
+			Tags{tag("x", ""), tag("y", "")},
+			[]string{"x", "y"},
+			[][]string{nil, nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ParseVersions(tt.tags)
+			got := DedupeCommits(tt.tags)
+			var names []string
+			var aliases [][]string
+			for _, tag := range got {
+				names = append(names, tag.Name)
+				aliases = append(aliases, tag.Aliases)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("got tags %q, want %q", names, tt.want)
+			}
+			if !reflect.DeepEqual(aliases, tt.wantAliases) {
+				t.Errorf("got aliases %q, want %q", aliases, tt.wantAliases)
+			}
+		})
+	}
+}
+
+func TestAnnotated(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  Tag
+		want bool
+	}{
+		{"target is a tag object", Tag{Target: "t1", Commit: Commit{ID: "c1"}, Message: ""}, true},
+		{"target is the commit", Tag{Target: "c1", Commit: Commit{ID: "c1"}}, false},
+		{"target is the commit, with a message", Tag{Target: "c1", Commit: Commit{ID: "c1"}, Message: "release"}, false},
+		{"no target, message", Tag{Commit: Commit{ID: "c1"}, Message: "release"}, true},
+		{"no target, tagger", Tag{Tagger: "Jane"}, true},
+		{"no target, date", Tag{CreatedAt: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)}, true},
+		{"no target, nothing else", Tag{Commit: Commit{ID: "c1"}}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.tag.Annotated(); got != tt.want {
+			t.Errorf("%s: Annotated() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	tags := Tags{
+		{Name: "v1.0.0", Target: "t1", Commit: Commit{ID: "c1"}},
+		{Name: "deploy-1", Target: "c1", Commit: Commit{ID: "c1"}},
+	}
+	if got := AnnotatedOnly(tags); len(got) != 1 || got[0].Name != "v1.0.0" {
+		t.Errorf("AnnotatedOnly kept %v, want only v1.0.0", got)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressDelay is how long fetching runs before progress is shown, so that
+// quick runs print nothing extra.
+const progressDelay = time.Second
+
+// progress shows on stderr how many pages of tags have been fetched, and for
+// which of several projects, so that a long scan can be seen not to have
+// hung. It is nil, showing nothing, unless stderr is a terminal.
+var prog *progress
+
+// progress is the state of the progress line.
+type progress struct {
+	mu    sync.Mutex
+	start time.Time
+
+	project      string
+	index, count int // position of project among the projects listed
+	pages, total int // pages of the current listing fetched, and expected
+
+	width int // length of the line shown, or 0 if none is
+}
+
+// showProgress reports whether progress is shown: only on a terminal, and not
+// with -quiet or -v, whose log it would get in the way of.
+func showProgress() bool {
+	return isTerminal(os.Stderr) && !quiet && !verbose && !vverbose
+}
+
+// startProgress sets up the progress line. The log is written through
+// progressWriter, which clears it first, so that log lines are not mixed
+// with it.
+func startProgress() {
+	prog = &progress{}
+}
+
+// setProject starts counting the pages of project, the index-th of count.
+func (p *progress) setProject(project string, index, count int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.project, p.index, p.count = project, index, count
+	p.pages, p.total = 0, 0
+}
+
+// page records that a page was fetched, its response having header, and
+// redraws the line.
+func (p *progress) page(header http.Header) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.start.IsZero() {
+		p.start = time.Now()
+	}
+	p.pages++
+	if total, err := strconv.Atoi(header.Get("X-Total-Pages")); err == nil {
+		p.total = total
+	}
+	if time.Since(p.start) < progressDelay {
+		return
+	}
+
+	s := "Fetching "
+	if p.project != "" {
+		s += p.project
+		if p.count > 1 {
+			s += fmt.Sprintf(" (project %d of %d)", p.index, p.count)
+		}
+		s += ": "
+	}
+	s += "page " + strconv.Itoa(p.pages)
+	if p.total >= p.pages {
+		s += " of " + strconv.Itoa(p.total)
+	}
+	// Pad with spaces rather than using an escape sequence to clear the
+	// rest of the line, which not every Windows console understands.
+	n := len([]rune(s))
+	if n < p.width {
+		s += strings.Repeat(" ", p.width-n)
+	} else {
+		p.width = n
+	}
+	fmt.Fprint(os.Stderr, "\r"+s)
+}
+
+// clear removes the progress line, if it is shown, and starts counting the
+// pages of the next listing.
+func (p *progress) clear() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clearLocked()
+	p.pages, p.total = 0, 0
+}
+
+func (p *progress) clearLocked() {
+	if p.width > 0 {
+		fmt.Fprint(os.Stderr, "\r"+strings.Repeat(" ", p.width)+"\r")
+		p.width = 0
+	}
+}
+
+// progressWriter clears the progress line before each write to w.
+type progressWriter struct {
+	w io.Writer
+}
+
+func (w progressWriter) Write(b []byte) (int, error) {
+	if prog != nil {
+		prog.mu.Lock()
+		prog.clearLocked()
+		prog.mu.Unlock()
+	}
+	return w.w.Write(b)
+}
+
+// progressTransport is an http.RoundTripper that counts the pages of results
+// it fetches, recognized by their page query parameter or pagination
+// headers, on prog.
+type progressTransport struct {
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *progressTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.Base.RoundTrip(req)
+	if err == nil && (req.URL.Query().Get("page") != "" || resp.Header.Get("X-Page") != "") {
+		prog.page(resp.Header)
+	}
+	return resp, err
+}
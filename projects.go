@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/jgoodall/gitlab-list-tags/pkg/gitlabtags"
+)
+
+var (
+	groupPath    string
+	subgroups    bool
+	projectsFile string
+	searchQuery  string
+	concurrency  int
+)
+
+// projectsFlags registers the flags selecting several projects at once on fs.
+func projectsFlags(fs *flag.FlagSet) {
+	fs.StringVar(&groupPath, "group", "", "Print the tags of every project in this group (e.g. group/subgroup) instead of one project")
+	fs.BoolVar(&subgroups, "include-subgroups", false, "With -group, include the projects in its subgroups")
+	fs.StringVar(&projectsFile, "projects-file", "", "Print the tags of every project in this file, one full path per line, or - for stdin")
+	concurrencyFlag(fs)
+}
+
+// concurrencyFlag registers the flag setting how many of several projects
+// are fetched at once on fs.
+func concurrencyFlag(fs *flag.FlagSet) {
+	fs.IntVar(&concurrency, "concurrency", 4, "Number of projects to fetch the tags of at once, when listing several")
+}
+
+// multiProject reports whether several projects were selected, by -group,
+// -projects-file, the search command, or the projects sending webhooks to
+// serve-webhook, rather than a single one.
+func multiProject() bool {
+	return groupPath != "" || projectsFile != "" || searchQuery != "" || webhookSecret != ""
+}
+
+// listProjects returns the full paths of the projects selected by -group,
+// -projects-file, and the search command, or nil if a single project was
+// given.
+func listProjects(ctx context.Context, c gitlabtags.Provider) []string {
+	if !multiProject() {
+		return nil
+	}
+	projects := []string{}
+	if groupPath != "" {
+		l, ok := c.(gitlabtags.GroupProjectLister)
+		if !ok {
+			fatal("the provider does not support -group", "provider", provider)
+		}
+		ps, err := l.ListGroupProjects(ctx, groupPath, subgroups)
+		if err != nil {
+			exitIfInterrupted(ctx)
+			fatal("error listing projects", "group", groupPath, "err", err)
+		}
+		for _, p := range ps {
+			projects = append(projects, p.PathWithNamespace)
+		}
+	}
+	if projectsFile != "" {
+		ps, err := readProjectsFile(projectsFile)
+		if err != nil {
+			fatal("error reading projects file", "projects_file", projectsFile, "err", err)
+		}
+		projects = append(projects, ps...)
+	}
+	if searchQuery != "" {
+		ps := searchProjects(ctx, c, searchQuery)
+		if len(ps) == 0 {
+			slog.Warn("no projects found", "query", searchQuery)
+			exit(&failure{exitNotFound, "no projects found"})
+		}
+		projects = append(projects, ps...)
+	}
+	prog.clear()
+	return projects
+}
+
+// readProjectsFile reads the project paths in the file at path, or stdin if
+// path is "-". Blank lines and lines starting with # are ignored.
+func readProjectsFile(path string) ([]string, error) {
+	r := os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var projects []string
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.Contains(strings.Trim(line, "/"), "/") {
+			return nil, fmt.Errorf("line %d: %q is not a full project path such as group/project", n, line)
+		}
+		projects = append(projects, strings.Trim(line, "/"))
+	}
+	return projects, s.Err()
+}
+
+// setCurrentProject makes the project with the given full path the one that
+// tags are listed for and linked to.
+func setCurrentProject(path string) {
+	i := strings.LastIndex(path, "/")
+	org, repo, projectID = path[:i], path[i+1:], ""
+}
+
+// projectResult is the outcome of listing the tags of one of several
+// projects, known once done is closed.
+type projectResult struct {
+	tags      gitlabtags.Tags
+	parseErrs []error
+	err       error
+	done      chan struct{}
+}
+
+// fetchProjects starts listing the tags of each of projects, -concurrency of
+// them at a time and in order, and returns their results in the same order.
+// The requests all go through c, so share its rate limiting.
+func fetchProjects(ctx context.Context, c gitlabtags.Provider, projects []string) []*projectResult {
+	if concurrency < 1 {
+		fatal("-concurrency must be positive")
+	}
+	opts := listOptions()
+	results := make([]*projectResult, len(projects))
+	jobs := make(chan int, len(projects))
+	for i := range projects {
+		results[i] = &projectResult{done: make(chan struct{})}
+		jobs <- i
+	}
+	close(jobs)
+	for w := 0; w < concurrency && w < len(projects); w++ {
+		go func() {
+			for i := range jobs {
+				r := results[i]
+				r.tags, r.parseErrs, r.err = c.ListTags(ctx, projects[i], opts)
+				close(r.done)
+			}
+		}()
+	}
+	return results
+}
+
+// printProjects prints the tags of each of projects with printer, in a
+// section headed by the project's path. For JSON output, a single array is
+// written instead, holding an object with the project's path and its tags
+// for each project. The tags are fetched concurrently, but printed in the
+// order of projects, each as soon as its own are fetched. It returns the
+// failure of -require-signed, if any of the tags is not signed.
+func printProjects(ctx context.Context, c gitlabtags.Provider, projects []string, printer func(io.Writer, gitlabtags.Tags) error) error {
+	type projectTags struct {
+		Project string          `json:"project"`
+		Tags    json.RawMessage `json:"tags"`
+	}
+	var (
+		combined []projectTags
+		all      gitlabtags.Tags
+	)
+	results := fetchProjects(ctx, c, projects)
+	for i, p := range projects {
+		setCurrentProject(p)
+		prog.setProject(p, i+1, len(projects))
+		r := results[i]
+		<-r.done
+		prog.clear()
+		if r.err != nil {
+			exitIfInterrupted(ctx)
+			fatal("error listing tags", "project", p, "err", r.err)
+		}
+		tags, parseErrs := selectNew(r.tags), r.parseErrs
+		all = append(all, tags...)
+		if output == "changelog" {
+			prepareChangelog(ctx, c, tags)
+		}
+
+		if latestOnly || latestMsg {
+			if latest := latestTag(tags); latest != nil {
+				fmt.Fprintf(out, "%s\t%s\n", p, latestText(latest))
+			}
+			recordNew(ctx, tags)
+			if strict {
+				printParseErrors(parseErrs)
+			}
+			continue
+		}
+		if output == "json" {
+			var buf bytes.Buffer
+			if err := printJSON(&buf, tags); err != nil {
+				fatal("error writing output", "output", "json", "err", err)
+			}
+			combined = append(combined, projectTags{p, buf.Bytes()})
+		} else {
+			// Porcelain and JSON Lines name their project, so need no
+			// headings.
+			if !porcelain && output != "jsonl" {
+				if i > 0 {
+					fmt.Fprintln(out)
+				}
+				fmt.Fprintf(out, "# %s\n\n", p)
+			}
+			if err := printer(out, tags); err != nil {
+				fatal("error writing output", "output", output, "err", err)
+			}
+		}
+		recordNew(ctx, tags)
+		printParseErrors(parseErrs)
+	}
+	if output == "json" && !latestOnly && !latestMsg {
+		if combined == nil {
+			combined = []projectTags{}
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(combined); err != nil {
+			fatal("error writing output", "output", "json", "err", err)
+		}
+	}
+	return checkSigned(all)
+}
+
+// runSearch lists the tags of every project matching the keyword given as
+// its argument, as the list command does for -group.
+func runSearch(ctx context.Context, fs *flag.FlagSet) {
+	if fs.NArg() != 1 || strings.TrimSpace(fs.Arg(0)) == "" {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	searchQuery = fs.Arg(0)
+	runList(ctx, fs)
+}
+
+// searchProjects returns the full paths of the projects matching query.
+func searchProjects(ctx context.Context, c gitlabtags.Provider, query string) []string {
+	s, ok := c.(gitlabtags.ProjectSearcher)
+	if !ok {
+		fatal("the provider cannot search for projects", "provider", provider)
+	}
+	ps, err := s.SearchProjects(ctx, query)
+	if err != nil {
+		exitIfInterrupted(ctx)
+		fatal("error searching for projects", "query", query, "err", err)
+	}
+	paths := make([]string, len(ps))
+	for i, p := range ps {
+		paths[i] = p.PathWithNamespace
+	}
+	return paths
+}
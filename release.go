@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jgoodall/gitlab-list-tags/pkg/gitlabtags"
+)
+
+var (
+	releaseName     string
+	releaseDesc     string
+	releaseDescFile string
+	releaseAssets   stringsFlag
+)
+
+// releaseFlags registers the flags of the release command on fs.
+func releaseFlags(fs *flag.FlagSet) {
+	connectionFlags(fs)
+	fs.StringVar(&releaseName, "name", "", "Title of the release (defaults to the tag name)")
+	fs.StringVar(&releaseDesc, "description", "", "Description of the release (by default one is generated from the commits since the previous version, or the tag message)")
+	fs.StringVar(&releaseDescFile, "description-file", "", "File to read the description of the release from")
+	notesTemplateFlag(fs)
+	fs.Var(&releaseAssets, "asset", "File to upload and attach to the release, such as a binary or checksums (may be repeated)")
+	dryRunFlag(fs)
+}
+
+// runRelease runs the release create command, which publishes a release from
+// an existing tag.
+func runRelease(ctx context.Context, fs *flag.FlagSet) {
+	if fs.NArg() != 2 || fs.Arg(0) != "create" {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	name := fs.Arg(1)
+	c := newClient(ctx)
+	r, ok := c.(gitlabtags.Releaser)
+	if !ok {
+		fatal("the provider cannot create releases", "provider", provider)
+	}
+
+	desc := releaseDesc
+	switch {
+	case releaseDesc != "" && releaseDescFile != "":
+		fatal("only one of -description and -description-file may be given")
+	case releaseDescFile != "":
+		b, err := ioutil.ReadFile(releaseDescFile)
+		if err != nil {
+			fatal("error reading description", "err", err)
+		}
+		desc = string(b)
+	case desc == "":
+		desc = releaseDescription(ctx, c, name)
+	}
+
+	release := gitlabtags.Release{TagName: name, Name: releaseName, Description: desc}
+	if dryRun {
+		printRelease(release)
+		return
+	}
+	for _, file := range releaseAssets {
+		release.Assets.Links = append(release.Assets.Links, uploadAsset(ctx, r, file))
+	}
+
+	created, err := r.CreateRelease(ctx, project(), release)
+	if err != nil {
+		exitIfInterrupted(ctx)
+		fatal("error creating release", "tag", name, "err", err)
+	}
+	fmt.Fprintf(os.Stderr, "Created release %s\n", created.Name)
+}
+
+// printRelease prints the release that would be created, with the assets
+// that would be uploaded, for -dry-run.
+func printRelease(release gitlabtags.Release) {
+	title := release.Name
+	if title == "" {
+		title = release.TagName
+	}
+	fmt.Printf("Would create release %s from tag %s of %s/%s\n", title, release.TagName, org, repo)
+	for _, file := range releaseAssets {
+		fi, err := os.Stat(file)
+		if err != nil {
+			fatal("error reading asset", "asset", file, "err", err)
+		}
+		fmt.Printf("Would upload %s (%d bytes)\n", filepath.Base(file), fi.Size())
+	}
+	fmt.Printf("\n%s\n", strings.TrimRight(release.Description, "\n"))
+}
+
+// uploadAsset uploads file to the project, returning the link to it.
+func uploadAsset(ctx context.Context, r gitlabtags.Releaser, file string) gitlabtags.ReleaseLink {
+	f, err := os.Open(file)
+	if err != nil {
+		fatal("error reading asset", "asset", file, "err", err)
+	}
+	defer f.Close()
+	link, err := r.UploadAsset(ctx, project(), filepath.Base(file), f)
+	if err != nil {
+		exitIfInterrupted(ctx)
+		fatal("error uploading asset", "asset", file, "err", err)
+	}
+	fmt.Fprintf(os.Stderr, "Uploaded %s\n", link.URL)
+	return link
+}
+
+// releaseDescription generates the description of the release of the tag
+// called name: a list of the commits since the previous version, or the tag
+// message if there is no previous version. With -notes-template, the
+// template is executed for the tag instead.
+func releaseDescription(ctx context.Context, c gitlabtags.Provider, name string) string {
+	parseNotesTemplate()
+	sortSemver, since = true, "0.0.0"
+	tags, _ := listTags(ctx, c)
+	for i, tag := range tags {
+		if tag.Name != name {
+			continue
+		}
+		var (
+			prev    *gitlabtags.Tag
+			commits []gitlabtags.Commit
+		)
+		for j := i + 1; j < len(tags); j++ {
+			if tags[j].Parsed {
+				prev = &tags[j]
+				break
+			}
+		}
+		if prev != nil {
+			cmp, err := c.CompareRefs(ctx, project(), prev.Name, name)
+			if err != nil {
+				exitIfInterrupted(ctx)
+				fatal("error comparing tags", "from", prev.Name, "to", name, "err", err)
+			}
+			commits = cmp.Commits
+		}
+		if notesTmpl != nil {
+			return renderNotes(newReleaseNotes(tag, prev, commits))
+		}
+		if len(commits) == 0 {
+			return tag.Message
+		}
+		var b strings.Builder
+		for j := len(commits) - 1; j >= 0; j-- {
+			fmt.Fprintf(&b, "- %s (%s)\n", commits[j].Title, commits[j].ShortID)
+		}
+		return b.String()
+	}
+	slog.Error("tag not found", "tag", name)
+	exit(&failure{exitNotFound, "tag not found"})
+	return ""
+}
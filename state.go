@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/jgoodall/gitlab-list-tags/pkg/gitlabtags"
+)
+
+// stateFile returns the default file the latest tag seen in each project is
+// recorded in for -only-new, or an empty string if the user has no home
+// directory.
+func stateFile() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "gitlab-list-tags", "state.json")
+}
+
+// stateKey identifies the project, or the component of it selected by
+// -tag-prefix, in the state file.
+func stateKey() string {
+	key := provider + " " + hostURL() + " " + org + "/" + repo
+	if tagPrefix != "" {
+		key += " " + tagPrefix
+	}
+	return key
+}
+
+// readState returns the latest tag seen in each project, by stateKey.
+func readState() map[string]string {
+	state := map[string]string{}
+	b, err := ioutil.ReadFile(statePath)
+	if os.IsNotExist(err) {
+		return state
+	}
+	if err != nil {
+		fatal("error reading state file", "state_file", statePath, "err", err)
+	}
+	if err := json.Unmarshal(b, &state); err != nil {
+		fatal("error parsing state file", "state_file", statePath, "err", err)
+	}
+	return state
+}
+
+// newTags returns the tags with a greater version than the latest tag seen
+// in the project by a previous run. Every tag is new on the first run.
+func newTags(tags gitlabtags.Tags) gitlabtags.Tags {
+	last, ok := readState()[stateKey()]
+	if !ok {
+		return tags
+	}
+	seen := gitlabtags.Tags{{Name: last}}
+	if errs := parseTagVersions(seen); len(errs) > 0 {
+		fatal("error parsing last seen tag from state file", "state_file", statePath, "err", errs[0])
+	}
+	lastVers := seen[0].Version
+	var selected gitlabtags.Tags
+	for _, tag := range tags {
+		if tag.Parsed && gitlabtags.CompareVersions(tag.Version, lastVers) > 0 {
+			selected = append(selected, tag)
+		}
+	}
+	return selected
+}
+
+// saveSeen records the greatest version among tags as the latest tag seen in
+// the project, if -only-new is set.
+func saveSeen(tags gitlabtags.Tags) {
+	if !onlyNew {
+		return
+	}
+	latest := latestTag(tags)
+	if latest == nil {
+		return
+	}
+	state := readState()
+	state[stateKey()] = latest.Name
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		fatal("error encoding state", "err", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(statePath), 0700); err != nil {
+		fatal("error writing state file", "state_file", statePath, "err", err)
+	}
+	if err := ioutil.WriteFile(statePath, append(b, '\n'), 0600); err != nil {
+		fatal("error writing state file", "state_file", statePath, "err", err)
+	}
+}
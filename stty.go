@@ -0,0 +1,73 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// sttyEcho turns off echoing of input when stdin is a terminal, returning a
+// function that turns it back on.
+func sttyEcho() func() {
+	if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return func() {}
+	}
+	cmd := exec.Command("stty", "-echo")
+	cmd.Stdin = os.Stdin
+	if cmd.Run() != nil {
+		return func() {}
+	}
+	return func() {
+		cmd := exec.Command("stty", "echo")
+		cmd.Stdin = os.Stdin
+		cmd.Run()
+	}
+}
+
+// openTerminal opens the controlling terminal for reading keys from and
+// drawing on, for commands whose stdin and stdout may be redirected.
+func openTerminal() (in, out *os.File, err error) {
+	f, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	return f, f, err
+}
+
+// rawTerminal puts the terminal read from in, and written to out, in raw
+// mode, so that each key is read as it is pressed and not echoed, returning
+// a function that restores its previous mode.
+func rawTerminal(in, out *os.File) (func(), error) {
+	cmd := exec.Command("stty", "-g")
+	cmd.Stdin = in
+	saved, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	cmd = exec.Command("stty", "raw", "-echo")
+	cmd.Stdin = in
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	return func() {
+		cmd := exec.Command("stty", strings.TrimSpace(string(saved)))
+		cmd.Stdin = in
+		cmd.Run()
+	}, nil
+}
+
+// terminalSize returns the number of rows and columns of the terminal read
+// from in and written to out.
+func terminalSize(in, out *os.File) (rows, cols int, err error) {
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin = in
+	size, err := cmd.Output()
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := fmt.Sscan(string(size), &rows, &cols); err != nil {
+		return 0, 0, err
+	}
+	return rows, cols, nil
+}
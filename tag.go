@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jgoodall/gitlab-list-tags/pkg/gitlabtags"
+)
+
+var (
+	// assumeYes skips the confirmation prompt of destructive commands.
+	assumeYes bool
+
+	// dryRun prints what commands that write would change, without changing
+	// anything.
+	dryRun bool
+)
+
+// tagFlags registers the flags of the tag command on fs.
+func tagFlags(fs *flag.FlagSet) {
+	connectionFlags(fs)
+	fs.BoolVar(&assumeYes, "yes", false, "Delete without asking for confirmation")
+	dryRunFlag(fs)
+}
+
+// dryRunFlag registers the -dry-run flag on fs.
+func dryRunFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&dryRun, "dry-run", false, "Print what would be changed, without changing anything")
+}
+
+// runTag runs the tag delete command, which deletes a tag from the project,
+// and the tag protected command, which lists its protected tag patterns.
+func runTag(ctx context.Context, fs *flag.FlagSet) {
+	switch {
+	case fs.NArg() == 2 && fs.Arg(0) == "delete":
+		deleteTag(ctx, fs.Arg(1))
+	case fs.NArg() == 1 && fs.Arg(0) == "protected":
+		listProtectedTags(ctx)
+	default:
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+}
+
+// deleteTag deletes the tag called name, after asking for confirmation
+// unless -yes is set.
+func deleteTag(ctx context.Context, name string) {
+	d, ok := newClient(ctx).(gitlabtags.TagDeleter)
+	if !ok {
+		fatal("the provider cannot delete tags", "provider", provider)
+	}
+	if dryRun {
+		fmt.Printf("Would delete tag %s from %s/%s\n", name, org, repo)
+		return
+	}
+	if !assumeYes && !confirm(fmt.Sprintf("Delete tag %s from %s/%s?", name, org, repo)) {
+		fatal("not deleting; use -yes to delete without confirmation")
+	}
+	if err := d.DeleteTag(ctx, project(), name); err != nil {
+		exitIfInterrupted(ctx)
+		fatal("error deleting tag", "tag", name, "err", err)
+	}
+	fmt.Fprintf(os.Stderr, "Deleted tag %s\n", name)
+}
+
+// confirm asks the question on stderr and reports whether the answer read
+// from stdin was yes.
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// listProtectedTags prints each protected tag pattern and the roles allowed
+// to create tags matching it.
+func listProtectedTags(ctx context.Context) {
+	l, ok := newClient(ctx).(gitlabtags.ProtectedTagLister)
+	if !ok {
+		fatal("the provider cannot list protected tags", "provider", provider)
+	}
+	tags, err := l.ListProtectedTags(ctx, project())
+	if err != nil {
+		exitIfInterrupted(ctx)
+		fatal("error listing protected tags", "project", project(), "err", err)
+	}
+	for _, tag := range tags {
+		var levels []string
+		for _, l := range tag.CreateAccessLevels {
+			levels = append(levels, l.AccessLevelDescription)
+		}
+		fmt.Printf("%s\t%s\n", tag.Name, strings.Join(levels, ", "))
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32                       = syscall.NewLazyDLL("kernel32.dll")
+	procSetConsoleMode             = kernel32.NewProc("SetConsoleMode")
+	procGetConsoleScreenBufferInfo = kernel32.NewProc("GetConsoleScreenBufferInfo")
+)
+
+// Console modes, from the SetConsoleMode documentation.
+const (
+	enableProcessedInput            = 0x1
+	enableLineInput                 = 0x2
+	enableEchoInput                 = 0x4
+	enableVirtualTerminalInput      = 0x200
+	enableVirtualTerminalProcessing = 0x4
+)
+
+// openTerminal opens the console for reading keys from and drawing on, for
+// commands whose stdin and stdout may be redirected.
+func openTerminal() (in, out *os.File, err error) {
+	if in, err = os.OpenFile("CONIN$", os.O_RDWR, 0); err != nil {
+		return nil, nil, err
+	}
+	if out, err = os.OpenFile("CONOUT$", os.O_RDWR, 0); err != nil {
+		in.Close()
+		return nil, nil, err
+	}
+	return in, out, nil
+}
+
+// rawTerminal puts the console read from in, and written to out, in raw mode,
+// so that each key is read as it is pressed and not echoed, with keys such as
+// the arrows read, and escape sequences written, as on other terminals. It
+// returns a function that restores the previous modes.
+func rawTerminal(inFile, outFile *os.File) (func(), error) {
+	in, out := syscall.Handle(inFile.Fd()), syscall.Handle(outFile.Fd())
+	var inMode, outMode uint32
+	if err := syscall.GetConsoleMode(in, &inMode); err != nil {
+		return nil, err
+	}
+	if err := syscall.GetConsoleMode(out, &outMode); err != nil {
+		return nil, err
+	}
+	raw := inMode&^(enableProcessedInput|enableLineInput|enableEchoInput) | enableVirtualTerminalInput
+	if r, _, err := procSetConsoleMode.Call(uintptr(in), uintptr(raw)); r == 0 {
+		return nil, err
+	}
+	procSetConsoleMode.Call(uintptr(out), uintptr(outMode|enableVirtualTerminalProcessing))
+	return func() {
+		procSetConsoleMode.Call(uintptr(in), uintptr(inMode))
+		procSetConsoleMode.Call(uintptr(out), uintptr(outMode))
+	}, nil
+}
+
+// consoleScreenBufferInfo is the CONSOLE_SCREEN_BUFFER_INFO structure.
+type consoleScreenBufferInfo struct {
+	Size, CursorPosition     struct{ X, Y int16 }
+	Attributes               uint16
+	Left, Top, Right, Bottom int16
+	MaximumWindowSize        struct{ X, Y int16 }
+}
+
+// terminalSize returns the number of rows and columns of the window of the
+// console written to out.
+func terminalSize(in, out *os.File) (rows, cols int, err error) {
+	var info consoleScreenBufferInfo
+	if r, _, err := procGetConsoleScreenBufferInfo.Call(out.Fd(), uintptr(unsafe.Pointer(&info))); r == 0 {
+		return 0, 0, err
+	}
+	return int(info.Bottom-info.Top) + 1, int(info.Right-info.Left) + 1, nil
+}
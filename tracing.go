@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jgoodall/gitlab-list-tags/pkg/gitlabtags"
+)
+
+// traceExportInterval is how often the spans ended so far are exported, for
+// the long-running modes.
+const traceExportInterval = 5 * time.Second
+
+// Span kinds, as numbered by OTLP.
+const (
+	spanInternal = 1
+	spanClient   = 3
+)
+
+// Span status codes, as numbered by OTLP.
+const statusError = 2
+
+// tracer records the spans of the run, for OpenTelemetry. It is nil, tracing
+// nothing, unless an OTLP endpoint is configured.
+var tracer *otlpTracer
+
+// otlpTracer exports spans to an OpenTelemetry collector over OTLP/HTTP, in
+// its JSON encoding. It is configured by the standard OTEL_ environment
+// variables, so that it can be pointed at the collector a pipeline already
+// uses.
+type otlpTracer struct {
+	endpoint string
+	header   http.Header
+	service  string
+	parent   spanContext // from TRACEPARENT, if it is set
+	client   *http.Client
+
+	mu    sync.Mutex
+	ended []otlpSpan
+	root  *span
+}
+
+// spanContext identifies a span, as hex strings.
+type spanContext struct {
+	traceID, spanID string
+}
+
+type spanContextKey struct{}
+
+// span is a span that has not ended.
+type span struct {
+	t    *otlpTracer
+	data otlpSpan
+}
+
+// otlpSpan is a span in the OTLP JSON encoding.
+type otlpSpan struct {
+	TraceID      string          `json:"traceId"`
+	SpanID       string          `json:"spanId"`
+	ParentSpanID string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         int             `json:"kind"`
+	Start        string          `json:"startTimeUnixNano"`
+	End          string          `json:"endTimeUnixNano"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	Status       otlpStatus      `json:"status"`
+}
+
+// otlpAttribute is a string attribute in the OTLP JSON encoding.
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+// otlpStatus is the status of a span in the OTLP JSON encoding; the zero
+// value is unset.
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// newTracer returns a tracer exporting to the endpoint given by
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT, or nil
+// if neither is set or tracing is turned off by OTEL_SDK_DISABLED or
+// OTEL_TRACES_EXPORTER.
+func newTracer() *otlpTracer {
+	if os.Getenv("OTEL_SDK_DISABLED") == "true" || os.Getenv("OTEL_TRACES_EXPORTER") == "none" {
+		return nil
+	}
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" {
+		return nil
+	}
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	if protocol != "" && protocol != "http/json" {
+		slog.Warn("OTLP protocol is not supported; exporting traces with http/json", "protocol", protocol)
+	}
+
+	t := &otlpTracer{
+		endpoint: endpoint,
+		header:   http.Header{},
+		service:  os.Getenv("OTEL_SERVICE_NAME"),
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	if t.service == "" {
+		t.service = "gitlab-list-tags"
+	}
+	for _, env := range []string{"OTEL_EXPORTER_OTLP_HEADERS", "OTEL_EXPORTER_OTLP_TRACES_HEADERS"} {
+		for _, kv := range strings.Split(os.Getenv(env), ",") {
+			i := strings.Index(kv, "=")
+			if i < 0 {
+				continue
+			}
+			k, _ := url.QueryUnescape(strings.TrimSpace(kv[:i]))
+			v, _ := url.QueryUnescape(strings.TrimSpace(kv[i+1:]))
+			t.header.Set(k, v)
+		}
+	}
+	// CI systems that trace pipelines pass the span of the job in
+	// TRACEPARENT, as a W3C traceparent header.
+	if parts := strings.Split(os.Getenv("TRACEPARENT"), "-"); len(parts) == 4 && len(parts[1]) == 32 && len(parts[2]) == 16 {
+		t.parent = spanContext{parts[1], parts[2]}
+	}
+	return t
+}
+
+// startTracing sets up tracer and starts the span of the whole run of the
+// command called name. It returns a context holding the span, with which
+// the providers trace their operations, and a function ending the span and
+// exporting the spans.
+func startTracing(ctx context.Context, name string) (context.Context, func()) {
+	tracer = newTracer()
+	if tracer == nil {
+		return ctx, func() {}
+	}
+	ctx = gitlabtags.WithSpans(ctx, func(ctx context.Context, name string, attrs ...string) (context.Context, func(error)) {
+		ctx, s := tracer.start(ctx, name, spanInternal, attrs...)
+		return ctx, s.end
+	})
+	ctx, tracer.root = tracer.start(ctx, "gitlab-list-tags "+name, spanInternal)
+	go func() {
+		ticker := time.NewTicker(traceExportInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			tracer.export()
+		}
+	}()
+	return ctx, func() { flushTraces(nil) }
+}
+
+// flushTraces ends the span of the run, with err if it failed, and exports
+// the spans, before the program exits.
+func flushTraces(err error) {
+	if tracer == nil {
+		return
+	}
+	tracer.mu.Lock()
+	root := tracer.root
+	tracer.root = nil
+	tracer.mu.Unlock()
+	if root != nil {
+		root.end(err)
+	}
+	tracer.export()
+}
+
+// start starts a span named name, of the given kind, as a child of the span
+// in ctx, or of TRACEPARENT if there is none.
+func (t *otlpTracer) start(ctx context.Context, name string, kind int, attrs ...string) (context.Context, *span) {
+	parent, ok := ctx.Value(spanContextKey{}).(spanContext)
+	if !ok {
+		parent = t.parent
+	}
+	sc := spanContext{parent.traceID, randomID(8)}
+	if sc.traceID == "" {
+		sc.traceID = randomID(16)
+	}
+	s := &span{t: t, data: otlpSpan{
+		TraceID:      sc.traceID,
+		SpanID:       sc.spanID,
+		ParentSpanID: parent.spanID,
+		Name:         name,
+		Kind:         kind,
+		Start:        strconv.FormatInt(time.Now().UnixNano(), 10),
+	}}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		s.setAttribute(attrs[i], attrs[i+1])
+	}
+	return context.WithValue(ctx, spanContextKey{}, sc), s
+}
+
+// setAttribute adds the attribute key to s.
+func (s *span) setAttribute(key, value string) {
+	a := otlpAttribute{Key: key}
+	a.Value.StringValue = value
+	s.data.Attributes = append(s.data.Attributes, a)
+}
+
+// end ends s, with the error status if err is not nil, and queues it for
+// export.
+func (s *span) end(err error) {
+	s.data.End = strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err != nil {
+		s.data.Status = otlpStatus{Code: statusError, Message: err.Error()}
+	}
+	s.t.mu.Lock()
+	s.t.ended = append(s.t.ended, s.data)
+	s.t.mu.Unlock()
+}
+
+// export sends the spans ended since the last export to the collector.
+// Failures are logged, and the spans dropped.
+func (t *otlpTracer) export() {
+	t.mu.Lock()
+	spans := t.ended
+	t.ended = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+
+	service := otlpAttribute{Key: "service.name"}
+	service.Value.StringValue = t.service
+	payload := map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": []otlpAttribute{service}},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "github.com/jgoodall/gitlab-list-tags", "version": version},
+				"spans": spans,
+			}},
+		}},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("error exporting traces", "err", err)
+		return
+	}
+	req, err := http.NewRequest("POST", t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		slog.Error("error exporting traces", "err", err)
+		return
+	}
+	for k, v := range t.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		slog.Error("error exporting traces", "err", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		slog.Error("error exporting traces", "status", resp.Status, "response", string(bytes.TrimSpace(msg)))
+	}
+}
+
+// randomID returns n random bytes as a hex string, for the IDs of traces and
+// spans.
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// tracingTransport is an http.RoundTripper that traces each request it makes
+// in a client span, as a child of the span in the request's context.
+type tracingTransport struct {
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	_, s := tracer.start(req.Context(), "HTTP "+req.Method, spanClient,
+		"http.request.method", req.Method,
+		"url.full", gitlabtags.RedactURL(req.URL),
+		"server.address", req.URL.Hostname())
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		s.end(err)
+		return nil, err
+	}
+	s.setAttribute("http.response.status_code", strconv.Itoa(resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		err = errors.New(resp.Status)
+	}
+	s.end(err)
+	return resp, nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+var (
+	sshTunnel   string
+	dialCommand string
+)
+
+// tunnelFlags registers the flags reaching the server through a bastion on
+// fs.
+func tunnelFlags(fs *flag.FlagSet) {
+	fs.StringVar(&sshTunnel, "ssh-tunnel", "", "Reach the server through this SSH bastion, as [user@]host[:port], using the ssh command and its configuration (e.g. deploy@bastion.example.com)")
+	fs.StringVar(&dialCommand, "dial-command", "", "Command to connect to the server with, instead of -ssh-tunnel, like OpenSSH's ProxyCommand: it is run for each connection, with %h and %p replaced by the host and port, quoted, and talked to on its stdin and stdout")
+}
+
+// tunnelDialer returns the function dialing connections to the server through
+// -ssh-tunnel or -dial-command, or nil if neither is set.
+func tunnelDialer() func(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch {
+	case sshTunnel != "" && dialCommand != "":
+		fatal("only one of -ssh-tunnel and -dial-command may be given")
+	case sshTunnel == "" && dialCommand == "":
+		return nil
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if sshTunnel != "" {
+			return dialThrough(exec.Command("ssh", sshArgs(sshTunnel, host, port)...), addr)
+		}
+		command, err := expandDialCommand(dialCommand, host, port)
+		if err != nil {
+			return nil, err
+		}
+		if runtime.GOOS == "windows" {
+			return dialThrough(exec.Command("cmd", "/C", command), addr)
+		}
+		return dialThrough(exec.Command("/bin/sh", "-c", command), addr)
+	}
+}
+
+// sshArgs returns the arguments to ssh forwarding a connection to host and
+// port through the SSH bastion given as [user@]host[:port], with -W. They are
+// run without a shell, so the host, which comes from the server URL, cannot
+// be taken for anything but the -W target.
+func sshArgs(bastion, host, port string) []string {
+	args := []string{"-W", net.JoinHostPort(host, port)}
+	if i := strings.LastIndex(bastion, ":"); i > strings.LastIndex(bastion, "@") && !strings.HasSuffix(bastion, "]") {
+		args = append(args, "-p", bastion[i+1:])
+		bastion = bastion[:i]
+	}
+	return append(args, "--", strings.Trim(bastion, "[]"))
+}
+
+// expandDialCommand replaces %h and %p in the -dial-command command with host
+// and port, quoted for the shell running it, and %% with %. The URL parser
+// lets through hosts like "a;date", which must not run as commands.
+func expandDialCommand(command, host, port string) (string, error) {
+	quote := shellQuote
+	if runtime.GOOS == "windows" {
+		quote = cmdQuote
+	}
+	h, err := quote(host)
+	if err != nil {
+		return "", err
+	}
+	p, err := quote(port)
+	if err != nil {
+		return "", err
+	}
+	return strings.NewReplacer("%h", h, "%p", p, "%%", "%").Replace(command), nil
+}
+
+// shellQuote quotes s for /bin/sh, in single quotes, with any single quote in
+// it ended, escaped, and reopened.
+func shellQuote(s string) (string, error) {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'", nil
+}
+
+// cmdQuote quotes s for cmd.exe, in double quotes. Nothing can escape a double
+// quote there, and variables are expanded even in quotes, so s may not contain
+// '"', '%' or '!'.
+func cmdQuote(s string) (string, error) {
+	if strings.ContainsAny(s, `"%!`) {
+		return "", fmt.Errorf("cannot pass %q to -dial-command", s)
+	}
+	return `"` + s + `"`, nil
+}
+
+// dialThrough starts cmd, and returns a connection to addr reading from its
+// stdout and writing to its stdin. Its stderr is passed on, so that the user
+// sees why ssh fails to connect, or is asked for a password.
+func dialThrough(cmd *exec.Cmd, addr string) (net.Conn, error) {
+	command := strings.Join(cmd.Args, " ")
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		stdinR.Close()
+		stdinW.Close()
+		return nil, err
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdinR, stdoutW, progressWriter{os.Stderr}
+	err = cmd.Start()
+	stdinR.Close()
+	stdoutW.Close()
+	if err != nil {
+		stdinW.Close()
+		stdoutR.Close()
+		return nil, fmt.Errorf("error running %s: %w", command, err)
+	}
+	c := &cmdConn{cmd: cmd, command: command, r: stdoutR, w: stdinW, addr: addr, exited: make(chan struct{})}
+	go func() {
+		c.err = cmd.Wait()
+		close(c.exited)
+	}()
+	return c, nil
+}
+
+// cmdConn is a connection carried over the stdin and stdout of a command.
+type cmdConn struct {
+	cmd     *exec.Cmd
+	command string
+	r, w    *os.File
+	addr    string
+	read    bool
+
+	exited chan struct{} // closed once the command has exited, with err
+	err    error
+}
+
+// Read reads from the command's stdout. If the command fails before writing
+// anything, as when ssh cannot reach the bastion, its exit status is returned
+// rather than io.EOF.
+func (c *cmdConn) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	if n > 0 {
+		c.read = true
+	}
+	if err == io.EOF && !c.read {
+		select {
+		case <-c.exited:
+			if c.err != nil {
+				return n, fmt.Errorf("%s: %w", c.command, c.err)
+			}
+		case <-time.After(time.Second):
+		}
+	}
+	return n, err
+}
+
+func (c *cmdConn) Write(b []byte) (int, error) { return c.w.Write(b) }
+
+// Close closes the connection and stops the command.
+func (c *cmdConn) Close() error {
+	c.w.Close()
+	c.r.Close()
+	c.cmd.Process.Kill()
+	<-c.exited
+	return nil
+}
+
+func (c *cmdConn) LocalAddr() net.Addr  { return cmdAddr("command") }
+func (c *cmdConn) RemoteAddr() net.Addr { return cmdAddr(c.addr) }
+
+// Deadlines are only supported where pipes can have them, as on Unix.
+func (c *cmdConn) SetDeadline(t time.Time) error {
+	if err := c.r.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.w.SetWriteDeadline(t)
+}
+func (c *cmdConn) SetReadDeadline(t time.Time) error  { return c.r.SetReadDeadline(t) }
+func (c *cmdConn) SetWriteDeadline(t time.Time) error { return c.w.SetWriteDeadline(t) }
+
+// cmdAddr is the address of either end of a cmdConn.
+type cmdAddr string
+
+func (a cmdAddr) Network() string { return "command" }
+func (a cmdAddr) String() string  { return string(a) }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSSHArgs(t *testing.T) {
+	tests := []struct {
+		bastion, host, port string
+		want                []string
+	}{
+		{"bastion", "gitlab.example.com", "443", []string{"-W", "gitlab.example.com:443", "--", "bastion"}},
+		{"deploy@bastion:2222", "gitlab.example.com", "443", []string{"-W", "gitlab.example.com:443", "-p", "2222", "--", "deploy@bastion"}},
+		{"[::1]", "::2", "443", []string{"-W", "[::2]:443", "--", "::1"}},
+		{"[::1]:2222", "gitlab.example.com", "443", []string{"-W", "gitlab.example.com:443", "-p", "2222", "--", "::1"}},
+		{"bastion", "a;date>pwned;b", "443", []string{"-W", "a;date>pwned;b:443", "--", "bastion"}},
+	}
+	for _, tt := range tests {
+		if got := sshArgs(tt.bastion, tt.host, tt.port); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sshArgs(%q, %q, %q) = %q, want %q", tt.bastion, tt.host, tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"gitlab.example.com", "'gitlab.example.com'"},
+		{"a;date>pwned;b", "'a;date>pwned;b'"},
+		{"$(date)", "'$(date)'"},
+		{"it's", `'it'\''s'`},
+		{"", "''"},
+	}
+	for _, tt := range tests {
+		if got, _ := shellQuote(tt.in); got != tt.want {
+			t.Errorf("shellQuote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDialCommandQuotesHost(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("runs /bin/sh")
+	}
+	dir := t.TempDir()
+	pwned := filepath.Join(dir, "pwned")
+	defer func(old string) { dialCommand = old }(dialCommand)
+	dialCommand = "echo %h %p"
+	for _, host := range []string{
+		"a;touch " + pwned + ";b",
+		"$(touch " + pwned + ")",
+		"a&&touch " + pwned,
+		"a'`touch " + pwned + "`'b",
+	} {
+		conn, err := tunnelDialer()(context.Background(), "tcp", host+":443")
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := ioutil.ReadAll(conn)
+		conn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSpace(string(out)); got != host+" 443" {
+			t.Errorf("command got %q, want %q", got, host+" 443")
+		}
+		if _, err := os.Stat(pwned); err == nil {
+			t.Fatalf("host %q ran a command", host)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/blang/semver"
+	"github.com/jgoodall/gitlab-list-tags/pkg/gitlabtags"
+)
+
+var changelogFile string
+
+// updateChangelogFlags registers the flags of the update-changelog command on
+// fs.
+func updateChangelogFlags(fs *flag.FlagSet) {
+	connectionFlags(fs)
+	selectionFlags(fs)
+	changelogFlags(fs)
+	fs.StringVar(&changelogFile, "file", "CHANGELOG.md", "Changelog to add the missing versions to; it is created if it does not exist")
+	dryRunFlag(fs)
+}
+
+// runUpdateChangelog adds the entries of the versions newer than the newest
+// one in the changelog file to it, keeping the rest of the file as it is.
+func runUpdateChangelog(ctx context.Context, fs *flag.FlagSet) {
+	b, err := ioutil.ReadFile(changelogFile)
+	if err != nil && !os.IsNotExist(err) {
+		fatal("error reading changelog", "changelog_file", changelogFile, "err", err)
+	}
+	text := string(b)
+	newest, _, found := newestChangelogVersion(text)
+
+	// Entries are inserted newest first whatever -order says.
+	order = "desc"
+	c := newClient(ctx)
+	tags, parseErrs := listTags(ctx, c)
+
+	var missing gitlabtags.Tags
+	var base *gitlabtags.Tag
+	for i, tag := range tags {
+		switch {
+		case !found:
+			missing = append(missing, tag)
+		case !tag.Parsed:
+		case gitlabtags.CompareVersions(tag.Version, newest) > 0:
+			missing = append(missing, tag)
+		case base == nil && gitlabtags.CompareVersions(tag.Version, newest) == 0:
+			base = &tags[i]
+		}
+	}
+	if len(missing) == 0 {
+		fmt.Fprintf(os.Stderr, "%s is up to date\n", changelogFile)
+		return
+	}
+
+	// The newest version already in the changelog is only included so that
+	// the oldest missing one is compared with it.
+	all := append(gitlabtags.Tags(nil), missing...)
+	if base != nil {
+		all = append(all, *base)
+	}
+	prepareChangelog(ctx, c, all)
+	var entries, links bytes.Buffer
+	if err := writeChangelogEntries(&entries, all, len(missing)); err != nil {
+		fatal("error writing changelog", "changelog_file", changelogFile, "err", err)
+	}
+	if err := writeChangelogLinks(&links, all, len(missing)); err != nil {
+		fatal("error writing changelog", "changelog_file", changelogFile, "err", err)
+	}
+	exitIfFailed(checkSigned(missing))
+
+	if dryRun {
+		fmt.Printf("Would add %d versions to %s:\n\n%s", len(missing), changelogFile, strings.TrimLeft(entries.String(), "\n"))
+		if links.Len() > 0 {
+			fmt.Printf("\n%s", links.String())
+		}
+		printParseErrors(parseErrs)
+		return
+	}
+	text = insertChangelogEntries(text, entries.String(), links.String())
+	if err := writeFileAtomic(changelogFile, []byte(text)); err != nil {
+		fatal("error writing changelog", "changelog_file", changelogFile, "err", err)
+	}
+	fmt.Fprintf(os.Stderr, "Added %d versions to %s\n", len(missing), changelogFile)
+
+	printParseErrors(parseErrs)
+}
+
+// versionHeadingRE matches the heading of a version in a changelog, such as
+// "## [1.2.0] - 2020-01-02", capturing the version.
+var versionHeadingRE = regexp.MustCompile(`(?m)^## \[([^\]]+)\]`)
+
+// linkDefRE matches a markdown link reference definition, such as the
+// compare links at the end of a changelog.
+var linkDefRE = regexp.MustCompile(`(?m)^\[[^\]]+\]:[ \t]+\S`)
+
+// newestChangelogVersion returns the version of the first heading in text
+// that is a semantic version, such as the first after "## [Unreleased]", and
+// the offset of that heading, or found false if there is none.
+func newestChangelogVersion(text string) (v semver.Version, offset int, found bool) {
+	for _, m := range versionHeadingRE.FindAllStringSubmatchIndex(text, -1) {
+		v, err := semver.Parse(strings.TrimPrefix(text[m[2]:m[3]], "v"))
+		if err == nil {
+			return v, m[0], true
+		}
+	}
+	return semver.Version{}, len(text), false
+}
+
+// insertChangelogEntries returns the changelog text with entries, as written
+// by writeChangelogEntries, inserted before its newest version, and links
+// before its first link reference definition after that. text may be empty,
+// for a new changelog.
+func insertChangelogEntries(text, entries, links string) string {
+	if text == "" {
+		return changelogHeader + entries + "\n" + links
+	}
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	_, at, found := newestChangelogVersion(text)
+	if found {
+		entries = strings.TrimPrefix(entries, "\n") + "\n"
+	}
+	text = text[:at] + entries + text[at:]
+
+	rest := at + len(entries)
+	if loc := linkDefRE.FindStringIndex(text[rest:]); loc != nil {
+		i := rest + loc[0]
+		return text[:i] + links + text[i:]
+	}
+	return text + "\n" + links
+}
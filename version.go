@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+// version is the version of gitlab-list-tags, and commit and buildDate the
+// git commit and time it was built from, set at build time with e.g.
+// -ldflags "-X main.version=v1.2.3 -X main.commit=$(git rev-parse HEAD)
+// -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)". Those not set are taken
+// from the build information go build embeds, where it has them.
+var (
+	version   = "dev"
+	commit    string
+	buildDate string
+)
+
+var versionJSON bool
+
+// versionFlags registers the flags of the version command on fs.
+func versionFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&versionJSON, "json", false, "Print the build information as a JSON object")
+}
+
+// buildInfo describes the build of gitlab-list-tags.
+type buildInfo struct {
+	Version  string `json:"version"`
+	Commit   string `json:"commit,omitempty"`
+	Modified bool   `json:"modified,omitempty"`
+	Date     string `json:"date,omitempty"`
+	Go       string `json:"go"`
+	OS       string `json:"os"`
+	Arch     string `json:"arch"`
+}
+
+// readBuildInfo returns the build information set by -ldflags, completed with
+// the module version and version control details embedded by go build.
+func readBuildInfo() buildInfo {
+	info := buildInfo{
+		Version: version,
+		Commit:  commit,
+		Date:    buildDate,
+		Go:      runtime.Version(),
+		OS:      runtime.GOOS,
+		Arch:    runtime.GOARCH,
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	if info.Version == "dev" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		info.Version = bi.Main.Version
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = s.Value
+			}
+		case "vcs.time":
+			if info.Date == "" {
+				info.Date = s.Value
+			}
+		case "vcs.modified":
+			info.Modified = s.Value == "true" && commit == ""
+		}
+	}
+	return info
+}
+
+// runVersion prints the version of gitlab-list-tags, and the commit, date,
+// and Go version it was built with.
+func runVersion(ctx context.Context, fs *flag.FlagSet) {
+	info := readBuildInfo()
+	if versionJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(info); err != nil {
+			fatal("error writing output", "output", "json", "err", err)
+		}
+		return
+	}
+	fmt.Printf("gitlab-list-tags %s\n", info.Version)
+	if info.Commit != "" {
+		modified := ""
+		if info.Modified {
+			modified = " (modified)"
+		}
+		fmt.Printf("commit: %s%s\n", info.Commit, modified)
+	}
+	if info.Date != "" {
+		fmt.Printf("built: %s\n", info.Date)
+	}
+	fmt.Printf("go: %s %s/%s\n", info.Go, info.OS, info.Arch)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/jgoodall/gitlab-list-tags/pkg/gitlabtags"
+)
+
+var (
+	watch         bool
+	watchInterval time.Duration
+)
+
+// watchFlags registers the flags of watch mode on fs.
+func watchFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&watch, "watch", false, "Keep running, checking for new tags every -interval and printing them as they appear")
+	fs.DurationVar(&watchInterval, "interval", 5*time.Minute, "How often -watch checks for new tags")
+	metricsFlag(fs)
+}
+
+// watchTags checks for new tags every -interval until interrupted, printing
+// the tags that were not there the time before with printer and announcing
+// them with -notify. The tags there when it starts are not printed.
+func watchTags(ctx context.Context, c gitlabtags.Provider, printer func(io.Writer, gitlabtags.Tags) error) {
+	if watchInterval <= 0 {
+		fatal("-interval must be positive")
+	}
+	serveMetrics(ctx)
+	tags, _ := listTags(ctx, c)
+	metrics.recordLatest(project(), tags)
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		seen[tag.Name] = true
+	}
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "Watching %s for new tags every %s\n", project(), watchInterval)
+	}
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		tags, _, err := tryListTags(ctx, c)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			// Keep watching through outages; the tags are checked again
+			// next time.
+			slog.Error("error checking for new tags", "project", project(), "err", err)
+			continue
+		}
+		metrics.recordLatest(project(), tags)
+		var added gitlabtags.Tags
+		for _, tag := range tags {
+			if !seen[tag.Name] {
+				seen[tag.Name] = true
+				added = append(added, tag)
+			}
+		}
+		if len(added) == 0 {
+			continue
+		}
+		if err := printer(out, added); err != nil {
+			fatal("error writing output", "output", output, "err", err)
+		}
+		if err := notifyNew(ctx, added); err != nil {
+			slog.Error("error sending notifications", "project", project(), "err", err)
+		}
+		saveSeen(added)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jgoodall/gitlab-list-tags/pkg/gitlabtags"
+)
+
+var (
+	listenAddr    string
+	webhookSecret string
+	webhookFile   string
+)
+
+// webhookFlags registers the flags of the serve-webhook command on fs.
+func webhookFlags(fs *flag.FlagSet) {
+	connectionFlags(fs)
+	selectionFlags(fs)
+	changelogFlags(fs)
+	fs.StringVar(&listenAddr, "listen", ":8080", "Address to listen for webhooks on")
+	fs.StringVar(&webhookSecret, "secret", "", "Secret token of the webhook, which GitLab sends in X-Gitlab-Token; requests without it are rejected (or GITLAB_WEBHOOK_SECRET)")
+	fs.StringVar(&webhookFile, "changelog-file", "", "Regenerate this CHANGELOG.md whenever a tag is pushed")
+	metricsFlag(fs)
+}
+
+// tagPushEvent is the payload of a GitLab tag push webhook.
+type tagPushEvent struct {
+	ObjectKind string `json:"object_kind"`
+	Ref        string `json:"ref"`
+	After      string `json:"after"`
+	Message    string `json:"message"`
+	Project    struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+	} `json:"project"`
+}
+
+// deletedSHA is the SHA GitLab sends as the new commit of a deleted tag.
+const deletedSHA = "0000000000000000000000000000000000000000"
+
+// runServeWebhook listens for GitLab tag push webhooks until interrupted. For
+// each pushed tag that the selection flags select, it logs the tag, announces
+// it with -notify, and, with -changelog-file, regenerates the changelog. Only
+// the project given by the connection flags is handled, if one is.
+func runServeWebhook(ctx context.Context, fs *flag.FlagSet) {
+	if webhookSecret == "" {
+		fatal("-secret is required, so that only GitLab can trigger the webhook")
+	}
+	opts := listOptions()
+	c := newClient(ctx)
+	want := ""
+	if org != "" && repo != "" {
+		want = org + "/" + repo
+	}
+
+	// Tags are handled one at a time, in the order they were pushed, as the
+	// project being handled is kept in org and repo.
+	events := make(chan tagPushEvent, 16)
+	go func() {
+		for e := range events {
+			setCurrentProject(e.Project.PathWithNamespace)
+			tag := strings.TrimPrefix(e.Ref, "refs/tags/")
+			slog.Info("tag pushed", "tag", tag, "project", e.Project.PathWithNamespace)
+			pushed, _ := gitlabtags.SelectTags(gitlabtags.Tags{{Name: tag, Message: e.Message, Commit: gitlabtags.Commit{ID: e.After}}}, opts)
+			if len(pushed) == 0 {
+				slog.Info("tag not selected", "tag", tag, "project", e.Project.PathWithNamespace)
+				continue
+			}
+			parseTagVersions(pushed)
+			metrics.recordLatest(e.Project.PathWithNamespace, pushed)
+			if err := notifyNew(ctx, pushed); err != nil {
+				slog.Error("error sending notifications", "project", e.Project.PathWithNamespace, "err", err)
+			}
+			if webhookFile != "" {
+				regenerateChangelog(ctx, c)
+			}
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Gitlab-Token")), []byte(webhookSecret)) != 1 {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		var e tagPushEvent
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10<<20)).Decode(&e); err != nil {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+		switch {
+		case e.ObjectKind != "tag_push", e.After == deletedSHA, !strings.Contains(e.Project.PathWithNamespace, "/"):
+			// Other events, deleted tags, and payloads without a
+			// project are ignored.
+		case want != "" && e.Project.PathWithNamespace != want:
+			http.Error(w, "unexpected project", http.StatusForbidden)
+			return
+		default:
+			select {
+			case events <- e:
+			default:
+				http.Error(w, "too many events", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	serveMetrics(ctx)
+	srv := &http.Server{Addr: listenAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+	slog.Info("listening for webhooks", "listen", listenAddr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fatal("error serving webhooks", "listen", listenAddr, "err", err)
+	}
+}
+
+// regenerateChangelog writes the changelog of the current project to
+// -changelog-file. Errors are logged, so that the server keeps running.
+func regenerateChangelog(ctx context.Context, c gitlabtags.Provider) {
+	tags, _, err := tryListTags(ctx, c)
+	if err != nil {
+		slog.Error("error listing tags", "project", project(), "err", err)
+		return
+	}
+	metrics.recordLatest(project(), tags)
+	prepareChangelog(ctx, c, tags)
+	var b bytes.Buffer
+	if err := printChangelog(&b, tags); err != nil {
+		slog.Error("error writing changelog", "err", err)
+		return
+	}
+	if err := writeFileAtomic(webhookFile, b.Bytes()); err != nil {
+		slog.Error("error writing changelog", "changelog_file", webhookFile, "err", err)
+		return
+	}
+	slog.Info("wrote changelog", "changelog_file", webhookFile)
+}